@@ -3,7 +3,6 @@ package nifcloud
 import (
 	"fmt"
 	"github.com/kzmake/nifcloud-sdk-go/nifcloud"
-	"github.com/kzmake/nifcloud-sdk-go/nifcloud/credentials"
 	"github.com/kzmake/nifcloud-sdk-go/nifcloud/session"
 	"github.com/kzmake/nifcloud-sdk-go/service/computing"
 )
@@ -13,10 +12,18 @@ type Config struct {
 	SecretKey string
 	Region    string
 	Endpoint string
+
+	Profile               string
+	SharedCredentialsFile string
+
+	ForceDestroyProtected bool
 }
 
 type NifcloudClient struct {
 	computingconn *computing.Computing
+	instanceCache *instanceCache
+
+	forceDestroyProtected bool
 }
 
 func (c *Config) Client() (interface{}, error) {
@@ -24,11 +31,9 @@ func (c *Config) Client() (interface{}, error) {
 		return nil, fmt.Errorf("[Err] No Region Name for Nifcloud")
 	}
 
-	var credential *credentials.Credentials
-	if c.AccessKey != "" && c.SecretKey != "" {
-		credential = credentials.NewStaticCredentials(c.AccessKey, c.SecretKey, "")
-	} else {
-		credential = credentials.NewEnvCredentials()
+	credential, err := c.credentials()
+	if err != nil {
+		return nil, err
 	}
 
 	config := nifcloud.Config{
@@ -45,6 +50,8 @@ func (c *Config) Client() (interface{}, error) {
 	var client NifcloudClient
 
 	client.computingconn = computing.New(sess)
+	client.instanceCache = &instanceCache{}
+	client.forceDestroyProtected = c.ForceDestroyProtected
 
 	return &client, nil
 }
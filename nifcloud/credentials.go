@@ -0,0 +1,151 @@
+package nifcloud
+
+import (
+	"fmt"
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud/awserr"
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud/credentials"
+	"github.com/mitchellh/go-homedir"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const nifcloudEnvProviderName = "NifcloudEnvProvider"
+
+// nifcloudEnvProvider retrieves credentials from the NIFCLOUD_ACCESS_KEY_ID and
+// NIFCLOUD_SECRET_ACCESS_KEY environment variables. The SDK's own EnvProvider
+// only reads the AWS_* variables.
+type nifcloudEnvProvider struct {
+	retrieved bool
+}
+
+func (e *nifcloudEnvProvider) Retrieve() (credentials.Value, error) {
+	e.retrieved = false
+
+	id := os.Getenv("NIFCLOUD_ACCESS_KEY_ID")
+	secret := os.Getenv("NIFCLOUD_SECRET_ACCESS_KEY")
+
+	if id == "" {
+		return credentials.Value{ProviderName: nifcloudEnvProviderName},
+			awserr.New("EnvAccessKeyNotFound", "NIFCLOUD_ACCESS_KEY_ID not found in environment", nil)
+	}
+
+	if secret == "" {
+		return credentials.Value{ProviderName: nifcloudEnvProviderName},
+			awserr.New("EnvSecretNotFound", "NIFCLOUD_SECRET_ACCESS_KEY not found in environment", nil)
+	}
+
+	e.retrieved = true
+	return credentials.Value{
+		AccessKeyID:     id,
+		SecretAccessKey: secret,
+		ProviderName:    nifcloudEnvProviderName,
+	}, nil
+}
+
+func (e *nifcloudEnvProvider) IsExpired() bool {
+	return !e.retrieved
+}
+
+// credentialSource is a provider in the credential chain together with a
+// description used when no source yields credentials.
+type credentialSource struct {
+	description string
+	provider    credentials.Provider
+}
+
+// sharedCredentialsFilename expands the configured path, falling back to
+// $HOME/.nifcloud/credentials. The SDK itself falls back to ~/.aws.
+func (c *Config) sharedCredentialsFilename() (string, error) {
+	if c.SharedCredentialsFile != "" {
+		return homedir.Expand(c.SharedCredentialsFile)
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".nifcloud", "credentials"), nil
+}
+
+// credentialSources returns the providers tried, in order: static keys,
+// NIFCLOUD_* environment variables, AWS_* environment variables and the
+// shared credentials file. The AWS_* variables were the only environment
+// source before, and are kept so existing setups keep working.
+func (c *Config) credentialSources() ([]credentialSource, error) {
+	file, err := c.sharedCredentialsFilename()
+	if err != nil {
+		return nil, fmt.Errorf("Error resolving shared credentials file: %s", err)
+	}
+
+	profile := c.Profile
+	if profile == "" {
+		profile = "default"
+	}
+
+	return []credentialSource{
+		{
+			description: "static access_key and secret_key",
+			provider: &credentials.StaticProvider{Value: credentials.Value{
+				AccessKeyID:     c.AccessKey,
+				SecretAccessKey: c.SecretKey,
+			}},
+		},
+		{
+			description: "NIFCLOUD_ACCESS_KEY_ID and NIFCLOUD_SECRET_ACCESS_KEY environment variables",
+			provider:    &nifcloudEnvProvider{},
+		},
+		{
+			description: "AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables",
+			provider:    &credentials.EnvProvider{},
+		},
+		{
+			description: fmt.Sprintf("shared credentials file (%s, profile %q)", file, profile),
+			provider: &credentials.SharedCredentialsProvider{
+				Filename: file,
+				Profile:  profile,
+			},
+		},
+	}, nil
+}
+
+// credentials builds the credential chain and checks that one of its sources
+// yields credentials, returning an error naming every source tried otherwise.
+func (c *Config) credentials() (*credentials.Credentials, error) {
+	sources, err := c.credentialSources()
+	if err != nil {
+		return nil, err
+	}
+
+	providers := make([]credentials.Provider, 0, len(sources))
+	for _, s := range sources {
+		providers = append(providers, s.provider)
+	}
+
+	credential := credentials.NewCredentials(&credentials.ChainProvider{
+		Providers:     providers,
+		VerboseErrors: true,
+	})
+
+	if _, err := credential.Get(); err != nil {
+		var causes []error
+		if batchErr, ok := err.(awserr.BatchedErrors); ok {
+			causes = batchErr.OrigErrs()
+		}
+
+		tried := make([]string, 0, len(sources))
+		for i, s := range sources {
+			if i < len(causes) && causes[i] != nil {
+				tried = append(tried, fmt.Sprintf("  * %s: %s", s.description, causes[i]))
+			} else {
+				tried = append(tried, fmt.Sprintf("  * %s", s.description))
+			}
+		}
+
+		return nil, fmt.Errorf("No valid credential sources found for Nifcloud provider. Tried:\n%s",
+			strings.Join(tried, "\n"))
+	}
+
+	return credential, nil
+}
@@ -0,0 +1,208 @@
+package nifcloud
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud"
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud/awserr"
+	"github.com/kzmake/nifcloud-sdk-go/service/computing"
+	"log"
+)
+
+func dataSourceInstance() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceInstanceRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"instance_unique_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"image_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"key_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"security_groups": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"user_data": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"instance_type": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"availability_zone": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"disable_api_termination": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"accounting_type": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"admin": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"ip_type": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"instance_state": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"public_ip": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"private_ip": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"dns_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"launch_time": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"network_interfaces": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"network_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"network_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"ipaddress": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"mac_address": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceInstanceRead(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*NifcloudClient).computingconn
+
+	name, nameOk := d.GetOk("name")
+	uniqueId, uniqueIdOk := d.GetOk("instance_unique_id")
+	if !nameOk && !uniqueIdOk {
+		return fmt.Errorf("One of name or instance_unique_id must be assigned")
+	}
+
+	input := computing.DescribeInstancesInput{}
+	if nameOk {
+		input.InstanceId = []*string{nifcloud.String(name.(string))}
+	}
+
+	out, err := conn.DescribeInstances(&input)
+	if err != nil {
+		awsErr, ok := err.(awserr.Error)
+		if ok && awsErr.Code() == "Client.InvalidParameterNotFound.Instance" {
+			return fmt.Errorf("Your query returned no results. Please change your search criteria and try again.")
+		}
+		return fmt.Errorf("Error DescribeInstances: %s", err)
+	}
+
+	var reservations []*computing.ReservationSetItem
+	for _, r := range out.ReservationSet {
+		i := r.InstancesSet[0]
+		if uniqueIdOk && *i.InstanceUniqueId != uniqueId.(string) {
+			continue
+		}
+		reservations = append(reservations, r)
+	}
+
+	if len(reservations) < 1 {
+		return fmt.Errorf("Your query returned no results. Please change your search criteria and try again.")
+	}
+
+	if len(reservations) > 1 {
+		return fmt.Errorf("Your query returned more than one result. Please try a more specific search criteria.")
+	}
+
+	reservation := reservations[0]
+	instance := reservation.InstancesSet[0]
+
+	log.Printf("[DEBUG] Found Instance: %s", *instance.InstanceUniqueId)
+
+	d.SetId(*instance.InstanceUniqueId)
+
+	if err := setInstanceResourceData(d, meta, reservation); err != nil {
+		return err
+	}
+
+	// Unlike the resource, the data source exposes the decoded body itself.
+	content, err := describeInstanceUserData(meta, *instance.InstanceId)
+	if err != nil {
+		return fmt.Errorf("Error retrieving Instance: %s", err)
+	}
+	d.Set("user_data", content)
+
+	if err := d.Set("network_interfaces", flattenInstanceNetworkInterfaces(instance.NetworkInterfaceSet)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func flattenInstanceNetworkInterfaces(networkInterfaces []*computing.NetworkInterfaceSetItem) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(networkInterfaces))
+	for _, ni := range networkInterfaces {
+		networkInterface := map[string]interface{}{}
+		if ni.NiftyNetworkId != nil {
+			networkInterface["network_id"] = *ni.NiftyNetworkId
+		}
+		if ni.NiftyNetworkName != nil {
+			networkInterface["network_name"] = *ni.NiftyNetworkName
+		}
+		if ni.IpAddress != nil {
+			networkInterface["ipaddress"] = *ni.IpAddress
+		} else if ni.PrivateIpAddress != nil {
+			networkInterface["ipaddress"] = *ni.PrivateIpAddress
+		}
+		if ni.MacAddress != nil {
+			networkInterface["mac_address"] = *ni.MacAddress
+		}
+
+		result = append(result, networkInterface)
+	}
+
+	return result
+}
@@ -0,0 +1,159 @@
+package nifcloud
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud"
+	"github.com/kzmake/nifcloud-sdk-go/service/computing"
+	"log"
+	"regexp"
+	"time"
+)
+
+func dataSourceInstances() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceInstancesRead,
+
+		Schema: map[string]*schema.Schema{
+			"name_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.ValidateRegexp,
+			},
+			"instance_state": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"instance_type": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"availability_zone": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"security_group": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"names": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"instance_unique_ids": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"public_ips": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"private_ips": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+func dataSourceInstancesRead(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*NifcloudClient).computingconn
+
+	out, err := conn.DescribeInstances(&computing.DescribeInstancesInput{})
+	if err != nil {
+		return fmt.Errorf("Error DescribeInstances: %s", err)
+	}
+
+	var nameRegex *regexp.Regexp
+	if v, ok := d.GetOk("name_regex"); ok {
+		nameRegex = regexp.MustCompile(v.(string))
+	}
+
+	names := make([]string, 0)
+	uniqueIds := make([]string, 0)
+	publicIps := make([]string, 0)
+	privateIps := make([]string, 0)
+
+	for _, r := range out.ReservationSet {
+		if !instanceMatchesFilters(d, nameRegex, r) {
+			continue
+		}
+
+		i := r.InstancesSet[0]
+		names = append(names, nifcloud.StringValue(i.InstanceId))
+		uniqueIds = append(uniqueIds, nifcloud.StringValue(i.InstanceUniqueId))
+		publicIps = append(publicIps, nifcloud.StringValue(i.IpAddress))
+		privateIps = append(privateIps, nifcloud.StringValue(i.PrivateIpAddress))
+	}
+
+	log.Printf("[DEBUG] Found %d instances", len(names))
+
+	d.SetId(time.Now().UTC().String())
+
+	if err := d.Set("names", names); err != nil {
+		return err
+	}
+	if err := d.Set("instance_unique_ids", uniqueIds); err != nil {
+		return err
+	}
+	if err := d.Set("public_ips", publicIps); err != nil {
+		return err
+	}
+	if err := d.Set("private_ips", privateIps); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func instanceMatchesFilters(d *schema.ResourceData, nameRegex *regexp.Regexp, reservation *computing.ReservationSetItem) bool {
+	instance := reservation.InstancesSet[0]
+
+	if nameRegex != nil && !nameRegex.MatchString(nifcloud.StringValue(instance.InstanceId)) {
+		return false
+	}
+
+	if v, ok := d.GetOk("instance_state"); ok {
+		if instance.InstanceState == nil || nifcloud.StringValue(instance.InstanceState.Name) != v.(string) {
+			return false
+		}
+	}
+
+	if v, ok := d.GetOk("instance_type"); ok && nifcloud.StringValue(instance.InstanceType) != v.(string) {
+		return false
+	}
+
+	if v, ok := d.GetOk("availability_zone"); ok {
+		if instance.Placement == nil || nifcloud.StringValue(instance.Placement.AvailabilityZone) != v.(string) {
+			return false
+		}
+	}
+
+	if v, ok := d.GetOk("description"); ok && nifcloud.StringValue(instance.Description) != v.(string) {
+		return false
+	}
+
+	if v, ok := d.GetOk("security_group"); ok {
+		found := false
+		for _, sg := range reservation.GroupSet {
+			if nifcloud.StringValue(sg.GroupId) == v.(string) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,59 @@
+package nifcloud
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud"
+	"github.com/kzmake/nifcloud-sdk-go/service/computing"
+	"log"
+)
+
+func dataSourceKeyPair() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceKeyPairRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"fingerprint": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceKeyPairRead(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*NifcloudClient).computingconn
+
+	input := computing.DescribeKeyPairsInput{
+		KeyName: []*string{nifcloud.String(d.Get("name").(string))},
+	}
+
+	out, err := conn.DescribeKeyPairs(&input)
+	if err != nil {
+		if isKeyPairNotFoundError(err) {
+			return fmt.Errorf("Your query returned no results. Please change your search criteria and try again.")
+		}
+		return fmt.Errorf("Error DescribeKeyPairs: %s", err)
+	}
+
+	for _, key := range out.KeySet {
+		if *key.KeyName == d.Get("name").(string) {
+			log.Printf("[DEBUG] Found KeyPair: %s", *key.KeyName)
+
+			d.SetId(*key.KeyName)
+			d.Set("fingerprint", key.KeyFingerprint)
+			d.Set("description", key.Description)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Your query returned no results. Please change your search criteria and try again.")
+}
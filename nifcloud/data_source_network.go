@@ -0,0 +1,106 @@
+package nifcloud
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud"
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud/awserr"
+	"github.com/kzmake/nifcloud-sdk-go/service/computing"
+	"log"
+)
+
+func dataSourceNetwork() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceNetworkRead,
+
+		Schema: map[string]*schema.Schema{
+			"network_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"cidr_block": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"availability_zone": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"accounting_type": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"state": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"instances": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"routers": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+func dataSourceNetworkRead(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*NifcloudClient).computingconn
+
+	input := computing.NiftyDescribePrivateLansInput{}
+	if v, ok := d.GetOk("network_id"); ok {
+		input.NetworkId = []*string{nifcloud.String(v.(string))}
+	}
+	if v, ok := d.GetOk("name"); ok {
+		input.PrivateLanName = []*string{nifcloud.String(v.(string))}
+	}
+
+	out, err := conn.NiftyDescribePrivateLans(&input)
+	if err != nil {
+		awsErr, ok := err.(awserr.Error)
+		if ok && awsErr.Code() == "Client.InvalidParameterNotFound.NetworkId" {
+			return fmt.Errorf("Your query returned no results. Please change your search criteria and try again.")
+		}
+		return fmt.Errorf("Error NiftyDescribePrivateLans: %s", err)
+	}
+
+	var networks []*computing.PrivateLanSetItem
+	for _, n := range out.PrivateLanSet {
+		if v, ok := d.GetOk("cidr_block"); ok && nifcloud.StringValue(n.CidrBlock) != v.(string) {
+			continue
+		}
+		networks = append(networks, n)
+	}
+
+	if len(networks) < 1 {
+		return fmt.Errorf("Your query returned no results. Please change your search criteria and try again.")
+	}
+
+	if len(networks) > 1 {
+		return fmt.Errorf("Your query returned more than one result. Please try a more specific search criteria.")
+	}
+
+	network := networks[0]
+
+	log.Printf("[DEBUG] Found Network: %s", *network.NetworkId)
+
+	d.SetId(*network.NetworkId)
+	d.Set("network_id", network.NetworkId)
+
+	return setNetworkResourceData(d, meta, network)
+}
@@ -0,0 +1,131 @@
+package nifcloud
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud"
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud/awserr"
+	"github.com/kzmake/nifcloud-sdk-go/service/computing"
+	"log"
+)
+
+func dataSourceSecurityGroup() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceSecurityGroupRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"availability_zone": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"state": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"rules": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"protocol": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"from_port": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"to_port": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"in_out": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"cidr_ip": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"group_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"description": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceSecurityGroupRead(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*NifcloudClient).computingconn
+
+	input := computing.DescribeSecurityGroupsInput{
+		GroupName: []*string{nifcloud.String(d.Get("name").(string))},
+	}
+
+	out, err := conn.DescribeSecurityGroups(&input)
+	if err != nil {
+		awsErr, ok := err.(awserr.Error)
+		if ok && awsErr.Code() == "Client.InvalidParameterNotFound.SecurityGroup" {
+			return fmt.Errorf("Your query returned no results. Please change your search criteria and try again.")
+		}
+		return fmt.Errorf("Error DescribeSecurityGroups: %s", err)
+	}
+
+	if len(out.SecurityGroupInfo) < 1 {
+		return fmt.Errorf("Your query returned no results. Please change your search criteria and try again.")
+	}
+
+	securityGroup := out.SecurityGroupInfo[0]
+
+	log.Printf("[DEBUG] Found Security Group: %s", *securityGroup.GroupName)
+
+	d.SetId(*securityGroup.GroupName)
+	d.Set("name", securityGroup.GroupName)
+	d.Set("description", securityGroup.GroupDescription)
+	d.Set("availability_zone", securityGroup.AvailabilityZone)
+	d.Set("state", securityGroup.GroupStatus)
+
+	if err := d.Set("rules", flattenSecurityGroupRules(securityGroup.IpPermissions)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func flattenSecurityGroupRules(permissions []*computing.IpPermissionsSetItem) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(permissions))
+	for _, p := range permissions {
+		rule := map[string]interface{}{
+			"protocol":    nifcloud.StringValue(p.IpProtocol),
+			"from_port":   int(nifcloud.Int64Value(p.FromPort)),
+			"to_port":     int(nifcloud.Int64Value(p.ToPort)),
+			"in_out":      nifcloud.StringValue(p.InOut),
+			"description": nifcloud.StringValue(p.Description),
+		}
+		if len(p.IpRanges) > 0 {
+			rule["cidr_ip"] = nifcloud.StringValue(p.IpRanges[0].CidrIp)
+		}
+		if len(p.Groups) > 0 {
+			rule["group_name"] = nifcloud.StringValue(p.Groups[0].GroupName)
+		}
+
+		result = append(result, rule)
+	}
+
+	return result
+}
@@ -0,0 +1,43 @@
+package nifcloud
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/openpgp"
+	"strings"
+)
+
+// encryptValue encrypts value with a base64 encoded PGP public key and returns
+// the base64 encoded ciphertext, which can be decrypted with `gpg --decrypt`.
+func encryptValue(encryptionKey, value, description string) (string, error) {
+	decodedKey, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encryptionKey))
+	if err != nil {
+		return "", fmt.Errorf("Error decoding PGP key for %s: %s", description, err)
+	}
+
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(decodedKey))
+	if err != nil {
+		return "", fmt.Errorf("Error parsing PGP key for %s: %s", description, err)
+	}
+
+	if len(entities) == 0 {
+		return "", fmt.Errorf("Error parsing PGP key for %s: no key found", description)
+	}
+
+	var buf bytes.Buffer
+	w, err := openpgp.Encrypt(&buf, entities[:1], nil, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("Error encrypting %s: %s", description, err)
+	}
+
+	if _, err := w.Write([]byte(value)); err != nil {
+		return "", fmt.Errorf("Error encrypting %s: %s", description, err)
+	}
+
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("Error encrypting %s: %s", description, err)
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,13 @@
+package nifcloud
+
+import (
+	"testing"
+)
+
+func TestEncryptValue_emptyKey(t *testing.T) {
+	for _, key := range []string{"", " ", "\n"} {
+		if _, err := encryptValue(key, "secret", "test value"); err == nil {
+			t.Fatalf("expected an error for PGP key %q", key)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package nifcloud
+
+import (
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud"
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud/awserr"
+	"github.com/kzmake/nifcloud-sdk-go/service/computing"
+	"log"
+	"sync"
+	"time"
+)
+
+const instanceCacheTTL = 30 * time.Second
+
+// instanceCache memoizes the account-wide DescribeInstances listing for a short
+// period, so resolving many instances during one refresh costs a single call.
+type instanceCache struct {
+	mu           sync.Mutex
+	fetchedAt    time.Time
+	reservations []*computing.ReservationSetItem
+}
+
+func (c *instanceCache) describeAll(conn *computing.Computing) ([]*computing.ReservationSetItem, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.reservations != nil && time.Since(c.fetchedAt) < instanceCacheTTL {
+		return c.reservations, nil
+	}
+
+	out, err := conn.DescribeInstances(&computing.DescribeInstancesInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	c.reservations = out.ReservationSet
+	c.fetchedAt = time.Now()
+
+	return c.reservations, nil
+}
+
+func (c *instanceCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reservations = nil
+}
+
+// findInstanceReservation looks the instance up by name first and falls back to
+// resolving its InstanceUniqueId against the cached account-wide listing, which
+// covers instances renamed outside of Terraform. It returns nil if not found.
+func findInstanceReservation(meta interface{}, name string, uniqueId string) (*computing.ReservationSetItem, error) {
+	client := meta.(*NifcloudClient)
+	conn := client.computingconn
+
+	if name != "" {
+		reservation, err := describeInstanceByName(conn, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if reservation != nil && *reservation.InstancesSet[0].InstanceUniqueId == uniqueId {
+			return reservation, nil
+		}
+	}
+
+	log.Printf("[DEBUG] Resolving instance by unique id: %s", uniqueId)
+
+	reservations, err := client.instanceCache.describeAll(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range reservations {
+		i := r.InstancesSet[0]
+		if *i.InstanceUniqueId == uniqueId {
+			return describeInstanceByName(conn, *i.InstanceId)
+		}
+	}
+
+	return nil, nil
+}
+
+func describeInstanceByName(conn *computing.Computing, name string) (*computing.ReservationSetItem, error) {
+	out, err := conn.DescribeInstances(&computing.DescribeInstancesInput{
+		InstanceId: []*string{nifcloud.String(name)},
+	})
+	if err != nil {
+		awsErr, ok := err.(awserr.Error)
+		if ok && awsErr.Code() == "Client.InvalidParameterNotFound.Instance" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(out.ReservationSet) == 0 {
+		return nil, nil
+	}
+
+	return out.ReservationSet[0], nil
+}
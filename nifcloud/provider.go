@@ -21,6 +21,18 @@ func Provider() terraform.ResourceProvider {
 				Default:     "",
 				Description: "The secret key for API operations.",
 			},
+			"profile": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "",
+				Description: "The profile in the shared credentials file to use for API operations.",
+			},
+			"shared_credentials_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "",
+				Description: "The path to the shared credentials file. Defaults to $HOME/.nifcloud/credentials.",
+			},
 			"endpoint": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -31,10 +43,20 @@ func Provider() terraform.ResourceProvider {
 				Required:    true,
 				Description: "The region where Nifcloud operations will take place.",
 			},
+			"force_destroy_protected": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Disable termination protection of instances when destroying them.",
+			},
 		},
 
 		DataSourcesMap: map[string]*schema.Resource{
-			// "nifcloud_instance": dataSourceInstance(),
+			"nifcloud_instance":       dataSourceInstance(),
+			"nifcloud_instances":      dataSourceInstances(),
+			"nifcloud_network":        dataSourceNetwork(),
+			"nifcloud_security_group": dataSourceSecurityGroup(),
+			"nifcloud_keypair":        dataSourceKeyPair(),
 		},
 		ResourcesMap: map[string]*schema.Resource{
 			"nifcloud_instance": resourceInstance(),
@@ -51,6 +73,11 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 		SecretKey: d.Get("secret_key").(string),
 		Endpoint:  d.Get("endpoint").(string),
 		Region:    d.Get("region").(string),
+
+		Profile:               d.Get("profile").(string),
+		SharedCredentialsFile: d.Get("shared_credentials_file").(string),
+
+		ForceDestroyProtected: d.Get("force_destroy_protected").(bool),
 	}
 
 	return config.Client()
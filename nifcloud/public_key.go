@@ -0,0 +1,124 @@
+package nifcloud
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"strings"
+)
+
+var supportedPublicKeyAlgorithms = []string{
+	"ssh-rsa",
+	"ssh-ed25519",
+	"ecdsa-sha2-nistp256",
+	"ecdsa-sha2-nistp384",
+	"ecdsa-sha2-nistp521",
+}
+
+// parsePublicKeyMaterial accepts either an OpenSSH public key line such as
+// "ssh-rsa AAAA... comment" or that line base64 encoded, as the API expects,
+// and returns the algorithm and the decoded key blob.
+func parsePublicKeyMaterial(v string) (string, []byte, error) {
+	line := strings.TrimSpace(v)
+	if !strings.Contains(line, " ") {
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return "", nil, fmt.Errorf("public key is neither an OpenSSH public key nor base64 encoded: %s", err)
+		}
+		line = strings.TrimSpace(string(decoded))
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", nil, fmt.Errorf("public key must be in OpenSSH format, e.g. \"ssh-rsa AAAA... comment\"")
+	}
+
+	algorithm := fields[0]
+	supported := false
+	for _, a := range supportedPublicKeyAlgorithms {
+		if a == algorithm {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return "", nil, fmt.Errorf("unsupported public key algorithm %q, must be one of %s",
+			algorithm, strings.Join(supportedPublicKeyAlgorithms, ", "))
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", nil, fmt.Errorf("public key data is not valid base64: %s", err)
+	}
+
+	// The blob starts with the length-prefixed algorithm name.
+	if len(blob) < 4 {
+		return "", nil, fmt.Errorf("public key data is truncated")
+	}
+	n := binary.BigEndian.Uint32(blob[:4])
+	if uint32(len(blob)-4) < n || string(blob[4:4+n]) != algorithm {
+		return "", nil, fmt.Errorf("public key data does not match algorithm %q", algorithm)
+	}
+
+	return algorithm, blob, nil
+}
+
+// encodePublicKeyMaterial returns the base64 encoded OpenSSH line the
+// ImportKeyPair API expects, whatever form the key was given in.
+func encodePublicKeyMaterial(v string) (string, error) {
+	algorithm, blob, err := parsePublicKeyMaterial(v)
+	if err != nil {
+		return "", err
+	}
+
+	line := algorithm + " " + base64.StdEncoding.EncodeToString(blob)
+	return base64.StdEncoding.EncodeToString([]byte(line)), nil
+}
+
+// publicKeyFingerprint returns the colon separated MD5 fingerprint of the key.
+func publicKeyFingerprint(v string) (string, error) {
+	_, blob, err := parsePublicKeyMaterial(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := md5.Sum(blob)
+	hexes := make([]string, 0, len(sum))
+	for _, b := range sum {
+		hexes = append(hexes, fmt.Sprintf("%02x", b))
+	}
+
+	return strings.Join(hexes, ":"), nil
+}
+
+func validatePublicKeyMaterial(v interface{}, k string) (ws []string, errors []error) {
+	if _, _, err := parsePublicKeyMaterial(v.(string)); err != nil {
+		errors = append(errors, fmt.Errorf("%q: %s", k, err))
+	}
+	return
+}
+
+// suppressEquivalentPublicKeyDiffs treats plain and base64 encoded forms of
+// the same key, with or without comment, as equal. DescribeKeyPairs does not
+// return the key itself, so an imported key pair has no public_key_material in
+// state and adopts the configured one; the fingerprint format NIFCLOUD reports
+// is not confirmed, so a mismatch is only logged on Read.
+func suppressEquivalentPublicKeyDiffs(k, old, new string, d *schema.ResourceData) bool {
+	if old == "" {
+		return d.Id() != ""
+	}
+
+	oldAlgorithm, oldBlob, err := parsePublicKeyMaterial(old)
+	if err != nil {
+		return false
+	}
+
+	newAlgorithm, newBlob, err := parsePublicKeyMaterial(new)
+	if err != nil {
+		return false
+	}
+
+	return oldAlgorithm == newAlgorithm && string(oldBlob) == string(newBlob)
+}
@@ -0,0 +1,92 @@
+package nifcloud
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+// Fingerprints are the output of `ssh-keygen -l -E md5` for each key.
+const (
+	testPublicKeyRSA                = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC5hsUkUdBehBmqOAtxa5brSDc/fQqmmfwaAS6HdvUVxsH1ykxwC6mS1nDamTbVaM4PyPfOKoWIqY8qtf633uLRMwute2lnhbBraMq0LdWQpyqrFFnRBksdN0Bi9TErwjCuZdvW1CPUVwxENVOS+ANCWAgp63RzouerHElpHtdXvH28x/NkzHjxt/zEgEXNhEa7cHtxfWy1G0VbAVOsoWmhC8AUrd58FUDHhwBmYkS58WMXLEruIm2RWOvqxcmlJ4anCMIFCJ2yyECkxRwR3e7Kz/fPnRCNbMjqKxewmD/AyKrsQ11uxbxT6gkw62jlNNxrGRifSUXfQIVxCsudBKPx"
+	testPublicKeyRSAFingerprint     = "fc:e0:1f:b6:58:68:b9:32:f2:11:b1:90:31:aa:c9:74"
+	testPublicKeyEd25519            = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIMgfyCW1HLssi2vfb2vT0DbIe+EQ+sxyRDwwDkeiLtv/"
+	testPublicKeyEd25519Fingerprint = "26:96:7b:49:82:38:71:25:1c:04:30:0a:78:15:c4:99"
+	testPublicKeyECDSA              = "ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBEOywKH3cg6gu53XmdFmorgl0aDP+TOG1nIVdgg0xD8QPH8o8FwapJm1CLRlXPX7njYwSC5uEZNys+urJT0b9d4="
+	testPublicKeyECDSAFingerprint   = "22:7e:46:c3:c4:67:c7:e0:ce:76:3f:ae:90:95:0c:4e"
+)
+
+func TestParsePublicKeyMaterial(t *testing.T) {
+	cases := map[string]struct {
+		key       string
+		algorithm string
+		valid     bool
+	}{
+		"rsa":              {key: testPublicKeyRSA, algorithm: "ssh-rsa", valid: true},
+		"ed25519":          {key: testPublicKeyEd25519, algorithm: "ssh-ed25519", valid: true},
+		"ecdsa":            {key: testPublicKeyECDSA, algorithm: "ecdsa-sha2-nistp256", valid: true},
+		"with comment":     {key: testPublicKeyEd25519 + " user@example\n", algorithm: "ssh-ed25519", valid: true},
+		"base64 encoded":   {key: base64.StdEncoding.EncodeToString([]byte(testPublicKeyRSA)), algorithm: "ssh-rsa", valid: true},
+		"unsupported":      {key: "ssh-dss AAAAB3NzaC1kc3M=", valid: false},
+		"mismatched blob":  {key: "ssh-rsa AAAAC3NzaC1lZDI1NTE5AAAAIMgfyCW1HLssi2vfb2vT0DbIe+EQ+sxyRDwwDkeiLtv/", valid: false},
+		"invalid base64":   {key: "ssh-rsa not-base64!", valid: false},
+		"truncated":        {key: "ssh-rsa AAA=", valid: false},
+		"missing key data": {key: "ssh-rsa", valid: false},
+		"neither form":     {key: "not a key", valid: false},
+		"empty":            {key: "", valid: false},
+	}
+
+	for name, tc := range cases {
+		algorithm, blob, err := parsePublicKeyMaterial(tc.key)
+		if (err == nil) != tc.valid {
+			t.Fatalf("%s: expected valid %t, got error %v", name, tc.valid, err)
+		}
+
+		if tc.valid && (algorithm != tc.algorithm || len(blob) == 0) {
+			t.Fatalf("%s: expected algorithm %q and a key blob, got %q and %d bytes", name, tc.algorithm, algorithm, len(blob))
+		}
+	}
+}
+
+func TestEncodePublicKeyMaterial(t *testing.T) {
+	expected := base64.StdEncoding.EncodeToString([]byte(testPublicKeyRSA))
+
+	for _, key := range []string{
+		testPublicKeyRSA,
+		testPublicKeyRSA + " user@example",
+		"  " + testPublicKeyRSA + "\n",
+		expected,
+	} {
+		encoded, err := encodePublicKeyMaterial(key)
+		if err != nil {
+			t.Fatalf("%q: err: %s", key, err)
+		}
+
+		if encoded != expected {
+			t.Fatalf("%q: expected %q, got %q", key, expected, encoded)
+		}
+	}
+
+	if _, err := encodePublicKeyMaterial("not a key"); err == nil {
+		t.Fatal("expected an error for an invalid key")
+	}
+}
+
+func TestPublicKeyFingerprint(t *testing.T) {
+	cases := map[string]string{
+		testPublicKeyRSA:     testPublicKeyRSAFingerprint,
+		testPublicKeyEd25519: testPublicKeyEd25519Fingerprint,
+		testPublicKeyECDSA:   testPublicKeyECDSAFingerprint,
+		base64.StdEncoding.EncodeToString([]byte(testPublicKeyECDSA + " user@example")): testPublicKeyECDSAFingerprint,
+	}
+
+	for key, expected := range cases {
+		fingerprint, err := publicKeyFingerprint(key)
+		if err != nil {
+			t.Fatalf("%q: err: %s", key, err)
+		}
+
+		if fingerprint != expected {
+			t.Fatalf("%q: expected %s, got %s", key, expected, fingerprint)
+		}
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"github.com/kzmake/nifcloud-sdk-go/nifcloud/awserr"
 	"github.com/kzmake/nifcloud-sdk-go/service/computing"
 	"log"
+	"net"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,25 +21,48 @@ func resourceInstance() *schema.Resource {
 		Read:   resourceInstanceRead,
 		Update: resourceInstanceUpdate,
 		Delete: resourceInstanceDelete,
+
+		CustomizeDiff: resourceInstanceCustomizeDiff,
+
 		Importer: &schema.ResourceImporter{
 			State: func(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
 				conn := meta.(*NifcloudClient).computingconn
-				out, err := conn.DescribeInstances(&computing.DescribeInstancesInput{})
 
+				reservations, err := meta.(*NifcloudClient).instanceCache.describeAll(conn)
 				if err != nil {
 					return nil, fmt.Errorf("Error Import resource: %s", err)
 				}
 
-				for _, r := range out.ReservationSet {
+				// The import ID may be either the instance name or its InstanceUniqueId.
+				var matches []*computing.InstancesSetItem
+				for _, r := range reservations {
 					i := r.InstancesSet[0]
-					if *i.InstanceUniqueId == d.Id() {
-						d.Set("name", i.InstanceId)
-
-						return []*schema.ResourceData{d}, nil
+					if *i.InstanceUniqueId == d.Id() || *i.InstanceId == d.Id() {
+						matches = append(matches, i)
 					}
 				}
 
-				return nil, fmt.Errorf("Error Import resource: %s", d.Id())
+				if len(matches) < 1 {
+					return nil, fmt.Errorf("Error Import resource: no instance found with name or unique id %q", d.Id())
+				}
+
+				if len(matches) > 1 {
+					return nil, fmt.Errorf(
+						"Error Import resource: %q matches %d instances by name or unique id, import by InstanceUniqueId instead",
+						d.Id(), len(matches))
+				}
+
+				d.SetId(*matches[0].InstanceUniqueId)
+				d.Set("name", matches[0].InstanceId)
+
+				// Read only refreshes user data already in state, so seed it here.
+				content, err := describeInstanceUserData(meta, *matches[0].InstanceId)
+				if err != nil {
+					return nil, fmt.Errorf("Error Import resource: %s", err)
+				}
+				setInstanceUserDataHash(d, content)
+
+				return []*schema.ResourceData{d}, nil
 			},
 		},
 
@@ -62,18 +87,33 @@ func resourceInstance() *schema.Resource {
 			"key_name": {
 				Type:     schema.TypeString,
 				Required: true,
+				ForceNew: true,
 			},
 			"security_groups": {
-				Type:     schema.TypeList,
+				Type:     schema.TypeSet,
 				Optional: true,
 				MinItems: 0,
 				MaxItems: 1,
 				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
 			},
 			"user_data": {
-				Type:     schema.TypeString,
-				Optional: true,
-				ForceNew: true,
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"user_data_base64"},
+				StateFunc: func(v interface{}) string {
+					return userDataHashSum(v.(string))
+				},
+			},
+			"user_data_base64": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"user_data"},
+				ValidateFunc:  validateUserDataBase64,
+				StateFunc: func(v interface{}) string {
+					content, _ := decodeUserDataContent(v.(string))
+					return userDataHashSum(content)
+				},
 			},
 			"instance_type": {
 				Type:     schema.TypeString,
@@ -99,10 +139,13 @@ func resourceInstance() *schema.Resource {
 			"admin": {
 				Type:     schema.TypeString,
 				Optional: true,
+				ForceNew: true,
 			},
 			"password": {
-				Type:     schema.TypeString,
-				Optional: true,
+				Type:      schema.TypeString,
+				Optional:  true,
+				ForceNew:  true,
+				Sensitive: true,
 			},
 			"ip_type": {
 				Type:     schema.TypeString,
@@ -112,10 +155,21 @@ func resourceInstance() *schema.Resource {
 			"public_ip": {
 				Type:     schema.TypeString,
 				Optional: true,
+				Computed: true,
+				ForceNew: true,
+			},
+			"private_ip": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"dns_name": {
+				Type:     schema.TypeString,
+				Computed: true,
 			},
 			"agreement": {
 				Type:     schema.TypeBool,
 				Optional: true,
+				ForceNew: true,
 			},
 			"description": {
 				Type:     schema.TypeString,
@@ -124,6 +178,7 @@ func resourceInstance() *schema.Resource {
 			"network_interfaces": {
 				Type:     schema.TypeSet,
 				Optional: true,
+				Computed: true,
 				MinItems: 1,
 				MaxItems: 2,
 				Elem: &schema.Resource{
@@ -143,9 +198,16 @@ func resourceInstance() *schema.Resource {
 					},
 				},
 			},
+			"network_interfaces_reboot": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "false",
+				ValidateFunc: validation.StringInSlice([]string{"true", "force", "false"}, false),
+			},
 			"license": {
 				Type:     schema.TypeSet,
 				Optional: true,
+				ForceNew: true,
 				MinItems: 1,
 				MaxItems: 1,
 				Elem: &schema.Resource{
@@ -153,18 +215,106 @@ func resourceInstance() *schema.Resource {
 						"license_name": {
 							Type:     schema.TypeString,
 							Required: true,
+							ForceNew: true,
 						},
 						"license_num": {
 							Type:     schema.TypeString,
 							Required: true,
+							ForceNew: true,
 						},
 					},
 				},
 			},
-			"instance_state": {
+			"network_interface_addresses": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"network_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"network_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"ipaddress": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"mac_address": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+			"instance_unique_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"launch_time": {
 				Type:     schema.TypeString,
 				Computed: true,
 			},
+			"instance_state": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.StringInSlice([]string{"running", "stopped"}, false),
+			},
+			"reboot_trigger": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"force_reboot": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"readiness_check_port": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IntBetween(0, 65535),
+			},
+			"readiness_check_ip_type": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "public",
+				ValidateFunc: validation.StringInSlice([]string{"public", "private"}, false),
+			},
+			"readiness_check_timeout": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "5m",
+				ValidateFunc: validateDuration,
+			},
+			"wait_for_status_check": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"final_snapshot_name": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"final_image_name"},
+			},
+			"final_image_name": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"final_snapshot_name"},
+			},
+			"final_backup_timeout": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "60m",
+				ValidateFunc: validateDuration,
+			},
+			"allow_stopping_for_update": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
 		},
 	}
 }
@@ -173,51 +323,45 @@ func resourceInstanceCreate(d *schema.ResourceData, meta interface{}) error {
 	conn := meta.(*NifcloudClient).computingconn
 
 	var securityGroups []*string
-	if sgs := d.Get("security_groups").([]interface{}); sgs != nil {
-		for _, v := range sgs {
+	if sgs, ok := d.GetOk("security_groups"); ok {
+		for _, v := range sgs.(*schema.Set).List() {
 			securityGroups = append(securityGroups, nifcloud.String(v.(string)))
 		}
 	}
 
 	var networkInterfaces []*computing.RequestNetworkInterfaceStruct
 	if interfaces, ok := d.GetOk("network_interfaces"); ok {
-		for _, ni := range interfaces.(*schema.Set).List() {
-			networkInterface := &computing.RequestNetworkInterfaceStruct{}
-			if v, ok := ni.(*schema.ResourceData).GetOk("network_id"); ok {
-				networkInterface.SetNetworkId(v.(string))
-			}
-			if v, ok := ni.(*schema.ResourceData).GetOk("network_name"); ok {
-				networkInterface.SetNetworkName(v.(string))
-			}
-			if v, ok := ni.(*schema.ResourceData).GetOk("ipaddress"); ok {
-				networkInterface.SetIpAddress(v.(string))
-			}
-
-			networkInterfaces = append(networkInterfaces, networkInterface)
-		}
+		networkInterfaces = expandInstanceNetworkInterfaces(interfaces.(*schema.Set).List())
 	}
 
 	var licenses []*computing.RequestLicenseStruct
 	if licensesSet, ok := d.GetOk("license"); ok {
 		for _, l := range licensesSet.(*schema.Set).List() {
+			m := l.(map[string]interface{})
+
 			license := &computing.RequestLicenseStruct{}
-			if v, ok := l.(*schema.ResourceData).GetOk("license_name"); ok {
-				license.SetLicenseName(v.(string))
-			}
-			if v, ok := l.(*schema.ResourceData).GetOk("license_num"); ok {
-				license.SetLicenseNum(v.(string))
-			}
+			license.SetLicenseName(m["license_name"].(string))
+			license.SetLicenseNum(m["license_num"].(string))
 
 			licenses = append(licenses, license)
 		}
 	}
 
+	userData := d.Get("user_data").(string)
+	if v, ok := d.GetOk("user_data_base64"); ok {
+		payload, err := decodeUserDataBase64(v.(string))
+		if err != nil {
+			return err
+		}
+		userData = string(payload)
+	}
+
 	input := computing.RunInstancesInput{
 		InstanceId:            nifcloud.String(d.Get("name").(string)),
 		ImageId:               nifcloud.String(d.Get("image_id").(string)),
 		KeyName:               nifcloud.String(d.Get("key_name").(string)),
 		SecurityGroup:         securityGroups,
-		UserData:              nifcloud.String(d.Get("user_data").(string)),
+		UserData:              nifcloud.String(userData),
 		InstanceType:          nifcloud.String(d.Get("instance_type").(string)),
 		Placement:             &computing.RequestPlacementStruct{AvailabilityZone: nifcloud.String(d.Get("availability_zone").(string))},
 		DisableApiTermination: nifcloud.Bool(d.Get("disable_api_termination").(bool)),
@@ -237,6 +381,8 @@ func resourceInstanceCreate(d *schema.ResourceData, meta interface{}) error {
 		return fmt.Errorf("Error RunInstancesInput: %s", err)
 	}
 
+	meta.(*NifcloudClient).instanceCache.invalidate()
+
 	instance := out.InstancesSet[0]
 
 	log.Printf("[INFO] Instance Id: %s", *instance.InstanceId)
@@ -255,207 +401,459 @@ func resourceInstanceCreate(d *schema.ResourceData, meta interface{}) error {
 		MinTimeout: 5 * time.Second,
 	}
 
-	if _, err := stateConf.WaitForState(); err != nil {
+	running, err := stateConf.WaitForState()
+	if err != nil {
 		return fmt.Errorf(
 			"Error waiting for instance (%s) to become ready: %s",
 			*instance.InstanceId, err)
 	}
 
+	if d.Get("instance_state").(string) == "stopped" {
+		if err := stopInstance(d, meta, d.Timeout(schema.TimeoutCreate)); err != nil {
+			return err
+		}
+	} else if err := waitForInstanceReadiness(d, meta, running.(*computing.InstancesSetItem)); err != nil {
+		return err
+	}
+
 	return resourceInstanceRead(d, meta)
 }
 
-func resourceInstanceDelete(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*NifcloudClient).computingconn
+// waitForInstanceReadiness blocks until the optional status and port checks
+// pass, so that provisioners only start once the OS is actually up.
+func waitForInstanceReadiness(d *schema.ResourceData, meta interface{}, instance *computing.InstancesSetItem) error {
+	timeout, _ := time.ParseDuration(d.Get("readiness_check_timeout").(string))
+
+	if d.Get("wait_for_status_check").(bool) {
+		log.Printf("[DEBUG] Waiting for instance (%s) to report running steadily", d.Id())
+
+		// NIFCLOUD has no instance status check API, so require the instance to
+		// stay running without falling into warning for several polls in a row.
+		stateConf := &resource.StateChangeConf{
+			Pending:                   []string{"pending"},
+			Target:                    []string{"running"},
+			Refresh:                   InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning", "terminated"}),
+			Timeout:                   timeout,
+			MinTimeout:                10 * time.Second,
+			ContinuousTargetOccurence: 3,
+		}
 
-	stopInstancesInput := computing.StopInstancesInput{
-		InstanceId: []*string{nifcloud.String(d.Get("name").(string))},
-	}
-	if _, err := conn.StopInstances(&stopInstancesInput); err != nil {
-		awsErr, ok := err.(awserr.Error)
-		if ok && awsErr.Code() == "Server.ProcessingFailure.Instance.Stop" {
-			// 何もしないで継続
-		} else {
-			return fmt.Errorf("Error StopInstances: %s", err)
+		if _, err := stateConf.WaitForState(); err != nil {
+			return fmt.Errorf(
+				"Error waiting for instance (%s) status check: %s", d.Id(), err)
 		}
 	}
 
-	log.Printf("[DEBUG] Waiting for instance (%s) to become stopped", d.Id())
-
-	stopStateConf := &resource.StateChangeConf{
-		Pending:    []string{"pending", "running"},
-		Target:     []string{"stopped"},
-		Refresh:    InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning"}),
-		Timeout:    d.Timeout(schema.TimeoutDelete),
-		Delay:      10 * time.Second,
-		MinTimeout: 5 * time.Second,
+	port := d.Get("readiness_check_port").(int)
+	if port == 0 {
+		return nil
 	}
 
-	if _, err := stopStateConf.WaitForState(); err != nil {
-		return fmt.Errorf(
-			"Error waiting for instance (%s) to stopped: %s", d.Id(), err)
+	ip := nifcloud.StringValue(instance.IpAddress)
+	if d.Get("readiness_check_ip_type").(string) == "private" {
+		ip = nifcloud.StringValue(instance.PrivateIpAddress)
 	}
 
-	terminateInstancesInput := computing.TerminateInstancesInput{
-		InstanceId: []*string{nifcloud.String(d.Get("name").(string))},
-	}
-	if _, err := conn.TerminateInstances(&terminateInstancesInput); err != nil {
-		return fmt.Errorf("Error TerminateInstances: %s", err)
+	if ip == "" {
+		return fmt.Errorf(
+			"Instance (%s) has no %s IP address to check readiness on",
+			d.Id(), d.Get("readiness_check_ip_type").(string))
 	}
 
-	log.Printf("[DEBUG] Waiting for instance (%s) to become terminate", d.Id())
+	address := net.JoinHostPort(ip, strconv.Itoa(port))
 
-	terminateStateConf := &resource.StateChangeConf{
-		Pending:    []string{"pending", "running", "stopped"},
-		Target:     []string{"terminated"},
-		Refresh:    InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning"}),
-		Timeout:    d.Timeout(schema.TimeoutDelete),
-		Delay:      10 * time.Second,
-		MinTimeout: 5 * time.Second,
-	}
+	log.Printf("[DEBUG] Waiting for instance (%s) to accept connections on %s", d.Id(), address)
 
-	if _, err := terminateStateConf.WaitForState(); err != nil {
-		return fmt.Errorf(
-			"Error waiting for instance (%s) to terminate: %s", d.Id(), err)
-	}
+	return resource.Retry(timeout, func() *resource.RetryError {
+		conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+		if err != nil {
+			return resource.RetryableError(fmt.Errorf("Instance (%s) is not reachable on %s: %s", d.Id(), address, err))
+		}
+		conn.Close()
 
-	return nil
+		return nil
+	})
 }
 
-func resourceInstanceUpdate(d *schema.ResourceData, meta interface{}) error {
+// createInstanceFinalBackup takes the snapshot or image requested through
+// final_snapshot_name / final_image_name, so that a destroy is recoverable.
+func createInstanceFinalBackup(d *schema.ResourceData, meta interface{}) error {
 	conn := meta.(*NifcloudClient).computingconn
 
-	updateStateConf := &resource.StateChangeConf{
-		Pending:    []string{"pending"},
-		Target:     []string{"running", "stopped"},
-		Refresh:    InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning", "terminated"}),
-		Timeout:    d.Timeout(schema.TimeoutUpdate),
-		Delay:      10 * time.Second,
-		MinTimeout: 5 * time.Second,
-	}
+	// Backups of large disks outlast the delete timeout, so they have their own.
+	timeout, _ := time.ParseDuration(d.Get("final_backup_timeout").(string))
 
-	if d.HasChange("description") {
-		_, err := conn.ModifyInstanceAttribute(&computing.ModifyInstanceAttributeInput{
-			InstanceId: nifcloud.String(d.Get("name").(string)),
-			Attribute:  nifcloud.String("description"),
-			Value:      nifcloud.String(d.Get("description").(string)),
-		})
-		if err != nil {
-			return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
-		}
-
-		if _, err := updateStateConf.WaitForState(); err != nil {
-			return fmt.Errorf(
-				"Error waiting for instance (%s) to become ready: %s",
-				d.Id(), err)
-		}
-	}
+	if v, ok := d.GetOk("final_snapshot_name"); ok {
+		snapshotName := v.(string)
 
-	if d.HasChange("instance_type") {
-		_, err := conn.ModifyInstanceAttribute(&computing.ModifyInstanceAttributeInput{
-			InstanceId: nifcloud.String(d.Get("name").(string)),
-			Attribute:  nifcloud.String("instanceType"),
-			Value:      nifcloud.String(d.Get("instance_type").(string)),
+		_, err := conn.NiftyCreateInstanceSnapshot(&computing.NiftyCreateInstanceSnapshotInput{
+			InstanceId:   nifcloud.String(d.Get("name").(string)),
+			SnapshotName: nifcloud.String(snapshotName),
 		})
 		if err != nil {
-			return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
+			return fmt.Errorf("Error NiftyCreateInstanceSnapshot: %s", err)
 		}
 
-		if _, err := updateStateConf.WaitForState(); err != nil {
-			return fmt.Errorf(
-				"Error waiting for instance (%s) to become ready: %s",
-				d.Id(), err)
-		}
-	}
+		log.Printf("[DEBUG] Waiting for final snapshot (%s) to complete", snapshotName)
 
-	if d.HasChange("disable_api_termination") {
-		_, err := conn.ModifyInstanceAttribute(&computing.ModifyInstanceAttributeInput{
-			InstanceId: nifcloud.String(d.Get("name").(string)),
-			Attribute:  nifcloud.String("disableApiTermination"),
-			Value:      nifcloud.String(strconv.FormatBool(d.Get("disable_api_termination").(bool))),
-		})
-		if err != nil {
-			return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
+		stateConf := &resource.StateChangeConf{
+			Pending:    []string{"pending", "processing"},
+			Target:     []string{"normal"},
+			Refresh:    InstanceSnapshotStateRefreshFunc(meta, snapshotName, []string{"error"}),
+			Timeout:    timeout,
+			Delay:      10 * time.Second,
+			MinTimeout: 10 * time.Second,
 		}
 
-		if _, err := updateStateConf.WaitForState(); err != nil {
+		if _, err := stateConf.WaitForState(); err != nil {
 			return fmt.Errorf(
-				"Error waiting for instance (%s) to become ready: %s",
-				d.Id(), err)
+				"Error waiting for final snapshot (%s) of instance (%s): %s",
+				snapshotName, d.Id(), err)
 		}
 	}
 
-	if d.HasChange("name") {
-		before, after := d.GetChange("name")
-		_, err := conn.ModifyInstanceAttribute(&computing.ModifyInstanceAttributeInput{
-			InstanceId: nifcloud.String(before.(string)),
-			Attribute:  nifcloud.String("instanceName"),
-			Value:      nifcloud.String(after.(string)),
-		})
+	if v, ok := d.GetOk("final_image_name"); ok {
+		imageName := v.(string)
 
+		out, err := conn.CreateImage(&computing.CreateImageInput{
+			InstanceId:   nifcloud.String(d.Get("name").(string)),
+			Name:         nifcloud.String(imageName),
+			LeftInstance: nifcloud.Bool(true),
+		})
 		if err != nil {
-			return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
+			return fmt.Errorf("Error CreateImage: %s", err)
 		}
 
-		updateStateConf := &resource.StateChangeConf{
-			Pending:    []string{"pending", "terminated"},
-			Target:     []string{"running", "stopped"},
-			Refresh:    InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning"}),
-			Timeout:    d.Timeout(schema.TimeoutUpdate),
+		log.Printf("[DEBUG] Waiting for final image (%s) to become available", imageName)
+
+		stateConf := &resource.StateChangeConf{
+			Pending:    []string{"pending"},
+			Target:     []string{"available"},
+			Refresh:    ImageStateRefreshFunc(meta, *out.ImageId, []string{"failed"}),
+			Timeout:    timeout,
 			Delay:      10 * time.Second,
-			MinTimeout: 5 * time.Second,
+			MinTimeout: 10 * time.Second,
 		}
 
-		if _, err := updateStateConf.WaitForState(); err != nil {
+		if _, err := stateConf.WaitForState(); err != nil {
 			return fmt.Errorf(
-				"Error waiting for instance (%s) to become ready: %s",
-				d.Id(), err)
+				"Error waiting for final image (%s) of instance (%s): %s",
+				imageName, d.Id(), err)
 		}
 	}
 
-	if d.HasChange("accounting_type") {
-		_, err := conn.ModifyInstanceAttribute(&computing.ModifyInstanceAttributeInput{
-			InstanceId: nifcloud.String(d.Get("name").(string)),
-			Attribute:  nifcloud.String("accountingType"),
-			Value:      nifcloud.String(d.Get("accounting_type").(string)),
+	return nil
+}
+
+func InstanceSnapshotStateRefreshFunc(meta interface{}, snapshotName string, failStates []string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		conn := meta.(*NifcloudClient).computingconn
+
+		out, err := conn.NiftyDescribeInstanceSnapshots(&computing.NiftyDescribeInstanceSnapshotsInput{
+			SnapshotName: []*string{nifcloud.String(snapshotName)},
 		})
 		if err != nil {
-			return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
+			log.Printf("Error on InstanceSnapshotStateRefresh: %s", err)
+			return nil, "", err
 		}
 
-		if _, err := updateStateConf.WaitForState(); err != nil {
-			return fmt.Errorf(
-				"Error waiting for instance (%s) to become ready: %s",
-				d.Id(), err)
+		if len(out.SnapshotInfoSet) == 0 {
+			return nil, "pending", nil
+		}
+
+		snapshot := out.SnapshotInfoSet[0]
+		state := nifcloud.StringValue(snapshot.Status)
+
+		for _, failState := range failStates {
+			if state == failState {
+				return snapshot, state, fmt.Errorf("Failed to reach target state. Reason: %s", state)
+			}
 		}
+
+		return snapshot, state, nil
 	}
+}
 
-	if d.HasChange("security_groups") {
-		_, err := conn.ModifyInstanceAttribute(&computing.ModifyInstanceAttributeInput{
-			InstanceId: nifcloud.String(d.Get("name").(string)),
-			Attribute:  nifcloud.String("groupId"),
-			Value:      nifcloud.String(d.Get("security_groups").([]interface{})[0].(string)),
+func ImageStateRefreshFunc(meta interface{}, imageId string, failStates []string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		conn := meta.(*NifcloudClient).computingconn
+
+		out, err := conn.DescribeImages(&computing.DescribeImagesInput{
+			ImageId: []*string{nifcloud.String(imageId)},
 		})
 		if err != nil {
-			return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
+			log.Printf("Error on ImageStateRefresh: %s", err)
+			return nil, "", err
 		}
 
-		if _, err := updateStateConf.WaitForState(); err != nil {
-			return fmt.Errorf(
-				"Error waiting for instance (%s) to become ready: %s",
-				d.Id(), err)
+		if len(out.ImagesSet) == 0 {
+			return nil, "pending", nil
 		}
-	}
 
-	if d.HasChange("ip_type") {
-		_, err := conn.ModifyInstanceAttribute(&computing.ModifyInstanceAttributeInput{
+		image := out.ImagesSet[0]
+		state := nifcloud.StringValue(image.ImageState)
+
+		for _, failState := range failStates {
+			if state == failState {
+				return image, state, fmt.Errorf("Failed to reach target state. Reason: %s", state)
+			}
+		}
+
+		return image, state, nil
+	}
+}
+
+// disableInstanceTerminationProtection fails before anything is stopped when
+// the instance is protected, unless the provider allows forcing the destroy.
+func disableInstanceTerminationProtection(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*NifcloudClient).computingconn
+
+	out, err := conn.DescribeInstanceAttribute(&computing.DescribeInstanceAttributeInput{
+		InstanceId: nifcloud.String(d.Get("name").(string)),
+		Attribute:  nifcloud.String("disableApiTermination"),
+	})
+	if err != nil {
+		awsErr, ok := err.(awserr.Error)
+		if ok && awsErr.Code() == "Client.InvalidParameterNotFound.Instance" {
+			return nil
+		}
+		return fmt.Errorf("Error DescribeInstanceAttribute: %s", err)
+	}
+
+	if out.DisableApiTermination == nil {
+		return nil
+	}
+
+	protected, _ := strconv.ParseBool(nifcloud.StringValue(out.DisableApiTermination.Value))
+	if !protected {
+		return nil
+	}
+
+	if !meta.(*NifcloudClient).forceDestroyProtected {
+		return fmt.Errorf(
+			"Instance (%s) has disable_api_termination enabled and was not stopped or terminated. "+
+				"Set disable_api_termination = false and apply before destroying it, "+
+				"or set force_destroy_protected = true in the provider configuration",
+			d.Get("name").(string))
+	}
+
+	log.Printf("[WARN] Disabling termination protection of instance (%s) to destroy it", d.Id())
+
+	_, err = conn.ModifyInstanceAttribute(&computing.ModifyInstanceAttributeInput{
+		InstanceId: nifcloud.String(d.Get("name").(string)),
+		Attribute:  nifcloud.String("disableApiTermination"),
+		Value:      nifcloud.String("false"),
+	})
+	if err != nil {
+		return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
+	}
+
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{"pending"},
+		Target:     []string{"running", "stopped"},
+		Refresh:    InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning", "terminated"}),
+		Timeout:    d.Timeout(schema.TimeoutDelete),
+		Delay:      10 * time.Second,
+		MinTimeout: 5 * time.Second,
+	}
+
+	if _, err := stateConf.WaitForState(); err != nil {
+		return fmt.Errorf(
+			"Error waiting for instance (%s) to become ready: %s",
+			d.Id(), err)
+	}
+
+	return nil
+}
+
+func stopInstance(d *schema.ResourceData, meta interface{}, timeout time.Duration) error {
+	conn := meta.(*NifcloudClient).computingconn
+
+	if _, state, err := InstanceStateRefreshFunc(meta, d.Get("name").(string), nil)(); err == nil && state == "stopped" {
+		return nil
+	}
+
+	stopInstancesInput := computing.StopInstancesInput{
+		InstanceId: []*string{nifcloud.String(d.Get("name").(string))},
+	}
+	if _, err := conn.StopInstances(&stopInstancesInput); err != nil {
+		awsErr, ok := err.(awserr.Error)
+		if ok && awsErr.Code() == "Server.ProcessingFailure.Instance.Stop" {
+			// 何もしないで継続
+		} else {
+			return fmt.Errorf("Error StopInstances: %s", err)
+		}
+	}
+
+	log.Printf("[DEBUG] Waiting for instance (%s) to become stopped", d.Id())
+
+	stopStateConf := &resource.StateChangeConf{
+		Pending:    []string{"pending", "running"},
+		Target:     []string{"stopped"},
+		Refresh:    InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning"}),
+		Timeout:    timeout,
+		Delay:      10 * time.Second,
+		MinTimeout: 5 * time.Second,
+	}
+
+	if _, err := stopStateConf.WaitForState(); err != nil {
+		return fmt.Errorf(
+			"Error waiting for instance (%s) to stopped: %s", d.Id(), err)
+	}
+
+	return nil
+}
+
+func startInstance(d *schema.ResourceData, meta interface{}, timeout time.Duration) error {
+	conn := meta.(*NifcloudClient).computingconn
+
+	if _, state, err := InstanceStateRefreshFunc(meta, d.Get("name").(string), nil)(); err == nil && state == "running" {
+		return nil
+	}
+
+	startInstancesInput := computing.StartInstancesInput{
+		InstanceId: []*string{nifcloud.String(d.Get("name").(string))},
+	}
+	if _, err := conn.StartInstances(&startInstancesInput); err != nil {
+		return fmt.Errorf("Error StartInstances: %s", err)
+	}
+
+	log.Printf("[DEBUG] Waiting for instance (%s) to become running", d.Id())
+
+	startStateConf := &resource.StateChangeConf{
+		Pending:    []string{"pending", "stopped"},
+		Target:     []string{"running"},
+		Refresh:    InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning", "terminated"}),
+		Timeout:    timeout,
+		Delay:      10 * time.Second,
+		MinTimeout: 5 * time.Second,
+	}
+
+	if _, err := startStateConf.WaitForState(); err != nil {
+		return fmt.Errorf(
+			"Error waiting for instance (%s) to become running: %s", d.Id(), err)
+	}
+
+	return nil
+}
+
+func resourceInstanceDelete(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*NifcloudClient).computingconn
+
+	if err := disableInstanceTerminationProtection(d, meta); err != nil {
+		return err
+	}
+
+	if err := stopInstance(d, meta, d.Timeout(schema.TimeoutDelete)); err != nil {
+		return err
+	}
+
+	if err := createInstanceFinalBackup(d, meta); err != nil {
+		return err
+	}
+
+	terminateInstancesInput := computing.TerminateInstancesInput{
+		InstanceId: []*string{nifcloud.String(d.Get("name").(string))},
+	}
+	if _, err := conn.TerminateInstances(&terminateInstancesInput); err != nil {
+		return fmt.Errorf("Error TerminateInstances: %s", err)
+	}
+
+	meta.(*NifcloudClient).instanceCache.invalidate()
+
+	log.Printf("[DEBUG] Waiting for instance (%s) to become terminate", d.Id())
+
+	terminateStateConf := &resource.StateChangeConf{
+		Pending:    []string{"pending", "running", "stopped"},
+		Target:     []string{"terminated"},
+		Refresh:    InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning"}),
+		Timeout:    d.Timeout(schema.TimeoutDelete),
+		Delay:      10 * time.Second,
+		MinTimeout: 5 * time.Second,
+	}
+
+	if _, err := terminateStateConf.WaitForState(); err != nil {
+		return fmt.Errorf(
+			"Error waiting for instance (%s) to terminate: %s", d.Id(), err)
+	}
+
+	return nil
+}
+
+func resourceInstanceUpdate(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*NifcloudClient).computingconn
+
+	d.Partial(true)
+
+	// Every other call addresses the instance by name, so rename it first.
+	if d.HasChange("name") {
+		before, after := d.GetChange("name")
+		_, err := conn.ModifyInstanceAttribute(&computing.ModifyInstanceAttributeInput{
+			InstanceId: nifcloud.String(before.(string)),
+			Attribute:  nifcloud.String("instanceName"),
+			Value:      nifcloud.String(after.(string)),
+		})
+
+		if err != nil {
+			return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
+		}
+
+		meta.(*NifcloudClient).instanceCache.invalidate()
+
+		updateStateConf := &resource.StateChangeConf{
+			Pending:    []string{"pending", "terminated"},
+			Target:     []string{"running", "stopped"},
+			Refresh:    InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning"}),
+			Timeout:    d.Timeout(schema.TimeoutUpdate),
+			Delay:      10 * time.Second,
+			MinTimeout: 5 * time.Second,
+		}
+
+		if _, err := updateStateConf.WaitForState(); err != nil {
+			return fmt.Errorf(
+				"Error waiting for instance (%s) to become ready: %s",
+				d.Id(), err)
+		}
+
+		d.SetPartial("name")
+	}
+
+	// These attributes are sent back to back and waited for once. ipType goes
+	// last since it is the only one that moves the instance through pending.
+	modified := false
+	for _, a := range []struct{ key, attribute string }{
+		{"description", "description"},
+		{"disable_api_termination", "disableApiTermination"},
+		{"accounting_type", "accountingType"},
+		{"ip_type", "ipType"},
+	} {
+		if !d.HasChange(a.key) {
+			continue
+		}
+
+		_, err := conn.ModifyInstanceAttribute(&computing.ModifyInstanceAttributeInput{
 			InstanceId: nifcloud.String(d.Get("name").(string)),
-			Attribute:  nifcloud.String("ipType"),
-			Value:      nifcloud.String(d.Get("ip_type").(string)),
+			Attribute:  nifcloud.String(a.attribute),
+			Value:      nifcloud.String(fmt.Sprint(d.Get(a.key))),
 		})
 		if err != nil {
 			return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
 		}
 
+		d.SetPartial(a.key)
+		modified = true
+	}
+
+	if modified {
+		updateStateConf := &resource.StateChangeConf{
+			Pending:    []string{"pending"},
+			Target:     []string{"running", "stopped"},
+			Refresh:    InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning", "terminated"}),
+			Timeout:    d.Timeout(schema.TimeoutUpdate),
+			Delay:      10 * time.Second,
+			MinTimeout: 5 * time.Second,
+		}
+
 		if _, err := updateStateConf.WaitForState(); err != nil {
 			return fmt.Errorf(
 				"Error waiting for instance (%s) to become ready: %s",
@@ -463,37 +861,453 @@ func resourceInstanceUpdate(d *schema.ResourceData, meta interface{}) error {
 		}
 	}
 
+	if d.HasChange("security_groups") {
+		if err := updateInstanceSecurityGroups(d, meta); err != nil {
+			return err
+		}
+
+		d.SetPartial("security_groups")
+	}
+
+	if d.HasChange("instance_type") || d.HasChange("network_interfaces") {
+		if err := updateInstanceStopRequiredAttributes(d, meta); err != nil {
+			return err
+		}
+
+		d.SetPartial("instance_type")
+		d.SetPartial("network_interfaces")
+	}
+
+	if d.HasChange("instance_state") {
+		switch d.Get("instance_state").(string) {
+		case "running":
+			if err := startInstance(d, meta, d.Timeout(schema.TimeoutUpdate)); err != nil {
+				return err
+			}
+		case "stopped":
+			if err := stopInstance(d, meta, d.Timeout(schema.TimeoutUpdate)); err != nil {
+				return err
+			}
+		}
+
+		d.SetPartial("instance_state")
+	}
+
+	if d.HasChange("reboot_trigger") && d.Get("instance_state").(string) == "running" {
+		_, err := conn.RebootInstances(&computing.RebootInstancesInput{
+			InstanceId: []*string{nifcloud.String(d.Get("name").(string))},
+			Force:      nifcloud.Bool(d.Get("force_reboot").(bool)),
+		})
+		if err != nil {
+			return fmt.Errorf("Error RebootInstances: %s", err)
+		}
+
+		log.Printf("[DEBUG] Waiting for instance (%s) to become running", d.Id())
+
+		rebootStateConf := &resource.StateChangeConf{
+			Pending:    []string{"pending"},
+			Target:     []string{"running"},
+			Refresh:    InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning", "terminated"}),
+			Timeout:    d.Timeout(schema.TimeoutUpdate),
+			Delay:      10 * time.Second,
+			MinTimeout: 5 * time.Second,
+		}
+
+		if _, err := rebootStateConf.WaitForState(); err != nil {
+			return fmt.Errorf(
+				"Error waiting for instance (%s) to reboot: %s",
+				d.Id(), err)
+		}
+
+		d.SetPartial("reboot_trigger")
+	}
+
+	d.Partial(false)
+
 	return resourceInstanceRead(d, meta)
 }
 
-func resourceInstanceRead(d *schema.ResourceData, meta interface{}) error {
+// updateInstanceSecurityGroups moves the instance between firewall groups and
+// waits until every affected group has finished applying its rules.
+func updateInstanceSecurityGroups(d *schema.ResourceData, meta interface{}) error {
 	conn := meta.(*NifcloudClient).computingconn
 
-	input := computing.DescribeInstancesInput{}
+	o, n := d.GetChange("security_groups")
+	before := o.(*schema.Set)
+	after := n.(*schema.Set)
+	instanceId := nifcloud.String(d.Get("name").(string))
 
-	out, err := conn.DescribeInstances(&input)
-	if err != nil {
-		awsErr, ok := err.(awserr.Error)
-		if ok && awsErr.Code() == "Client.InvalidParameterNotFound.Instance" {
-			d.SetId("")
+	switch {
+	case before.Len() > 0 && after.Len() > 0:
+		_, err := conn.ModifyInstanceAttribute(&computing.ModifyInstanceAttributeInput{
+			InstanceId: instanceId,
+			Attribute:  nifcloud.String("groupId"),
+			Value:      nifcloud.String(after.List()[0].(string)),
+		})
+		if err != nil {
+			return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
+		}
+	case after.Len() > 0:
+		_, err := conn.RegisterInstancesWithSecurityGroup(&computing.RegisterInstancesWithSecurityGroupInput{
+			GroupName:  nifcloud.String(after.List()[0].(string)),
+			InstanceId: []*string{instanceId},
+		})
+		if err != nil {
+			return fmt.Errorf("Error RegisterInstancesWithSecurityGroup: %s", err)
+		}
+	case before.Len() > 0:
+		_, err := conn.DeregisterInstancesFromSecurityGroup(&computing.DeregisterInstancesFromSecurityGroupInput{
+			GroupName:  nifcloud.String(before.List()[0].(string)),
+			InstanceId: []*string{instanceId},
+		})
+		if err != nil {
+			return fmt.Errorf("Error DeregisterInstancesFromSecurityGroup: %s", err)
+		}
+	}
+
+	for _, v := range before.Union(after).List() {
+		groupName := v.(string)
+
+		log.Printf("[DEBUG] Waiting for security group (%s) to become applied", groupName)
+
+		stateConf := &resource.StateChangeConf{
+			Pending:    []string{"processing"},
+			Target:     []string{"applied"},
+			Refresh:    SecurityGroupStateRefreshFunc(meta, groupName),
+			Timeout:    d.Timeout(schema.TimeoutUpdate),
+			Delay:      5 * time.Second,
+			MinTimeout: 5 * time.Second,
+		}
+
+		if _, err := stateConf.WaitForState(); err != nil {
+			return fmt.Errorf(
+				"Error waiting for security group (%s) to become applied: %s",
+				groupName, err)
+		}
+	}
+
+	return nil
+}
+
+func SecurityGroupStateRefreshFunc(meta interface{}, groupName string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		conn := meta.(*NifcloudClient).computingconn
+
+		out, err := conn.DescribeSecurityGroups(&computing.DescribeSecurityGroupsInput{
+			GroupName: []*string{nifcloud.String(groupName)},
+		})
+		if err != nil {
+			log.Printf("Error on SecurityGroupStateRefresh: %s", err)
+			return nil, "", err
+		}
+
+		if len(out.SecurityGroupInfo) == 0 {
+			return nil, "", fmt.Errorf("Security group (%s) not found", groupName)
+		}
+
+		securityGroup := out.SecurityGroupInfo[0]
+
+		return securityGroup, nifcloud.StringValue(securityGroup.GroupStatus), nil
+	}
+}
+
+// updateInstanceStopRequiredAttributes applies the changes NIFCLOUD only accepts
+// on a stopped instance, and restores the previous power state afterwards.
+// A network_interfaces change on its own is applied to a running instance with
+// a reboot instead when network_interfaces_reboot is "true" or "force".
+func updateInstanceStopRequiredAttributes(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*NifcloudClient).computingconn
+
+	before, _ := d.GetChange("instance_state")
+	running := before.(string) == "running"
+	reboot := d.Get("network_interfaces_reboot").(string)
+	stop := instanceUpdateRequiresStop(d)
+
+	if instanceUpdateStopRefused(d) {
+		return instanceUpdateStopRefusedError(d.Get("name").(string))
+	}
+
+	if stop {
+		if err := stopInstance(d, meta, d.Timeout(schema.TimeoutUpdate)); err != nil {
+			return err
+		}
+	}
+
+	target := "stopped"
+	if running && !stop {
+		target = "running"
+	}
+
+	updateStateConf := &resource.StateChangeConf{
+		Pending:    []string{"pending"},
+		Target:     []string{target},
+		Refresh:    InstanceStateRefreshFunc(meta, d.Get("name").(string), []string{"warning", "terminated"}),
+		Timeout:    d.Timeout(schema.TimeoutUpdate),
+		Delay:      10 * time.Second,
+		MinTimeout: 5 * time.Second,
+	}
+
+	if d.HasChange("instance_type") {
+		_, err := conn.ModifyInstanceAttribute(&computing.ModifyInstanceAttributeInput{
+			InstanceId: nifcloud.String(d.Get("name").(string)),
+			Attribute:  nifcloud.String("instanceType"),
+			Value:      nifcloud.String(d.Get("instance_type").(string)),
+		})
+		if err != nil {
+			return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
+		}
+
+		if _, err := updateStateConf.WaitForState(); err != nil {
+			return fmt.Errorf(
+				"Error waiting for instance (%s) to become ready: %s",
+				d.Id(), err)
+		}
+	}
+
+	if d.HasChange("network_interfaces") {
+		// A stopped instance picks the change up on its next start.
+		if target == "stopped" {
+			reboot = "false"
+		}
+
+		_, err := conn.NiftyUpdateInstanceNetworkInterfaces(&computing.NiftyUpdateInstanceNetworkInterfacesInput{
+			InstanceId:       nifcloud.String(d.Get("name").(string)),
+			NetworkInterface: expandInstanceNetworkInterfaces(d.Get("network_interfaces").(*schema.Set).List()),
+			NiftyReboot:      nifcloud.String(reboot),
+		})
+		if err != nil {
+			return fmt.Errorf("Error NiftyUpdateInstanceNetworkInterfaces: %s", err)
+		}
+
+		if _, err := updateStateConf.WaitForState(); err != nil {
+			return fmt.Errorf(
+				"Error waiting for instance (%s) to become ready: %s",
+				d.Id(), err)
+		}
+	}
+
+	if stop && d.Get("instance_state").(string) != "stopped" {
+		if err := startInstance(d, meta, d.Timeout(schema.TimeoutUpdate)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourceInstanceCustomizeDiff(diff *schema.ResourceDiff, meta interface{}) error {
+	if err := forceNewOnUserDataChange(diff); err != nil {
+		return err
+	}
+
+	if err := validateInstanceWindowsFields(diff, meta); err != nil {
+		return err
+	}
+
+	return validateInstanceStopRequiredChanges(diff, meta)
+}
+
+// forceNewOnUserDataChange replaces the instance only when the user data
+// content changes. Both fields store the same content hash, so moving a body
+// between user_data and user_data_base64 is not a replacement.
+func forceNewOnUserDataChange(diff *schema.ResourceDiff) error {
+	changed := []string{}
+	for _, k := range []string{"user_data", "user_data_base64"} {
+		if diff.HasChange(k) {
+			changed = append(changed, k)
+		}
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	if diff.NewValueKnown("user_data") && diff.NewValueKnown("user_data_base64") {
+		oldUserData, newUserData := diff.GetChange("user_data")
+		oldUserDataBase64, newUserDataBase64 := diff.GetChange("user_data_base64")
+
+		// State holds the hash while the new values are as configured. The two
+		// fields conflict, so at most one of them is set on either side.
+		after := ""
+		if v := newUserData.(string); v != "" {
+			after = userDataHashSum(v)
+		}
+		if v := newUserDataBase64.(string); v != "" {
+			content, err := decodeUserDataContent(v)
+			if err != nil {
+				return err
+			}
+			after = userDataHashSum(content)
+		}
+
+		if oldUserData.(string)+oldUserDataBase64.(string) == after {
 			return nil
 		}
-		return fmt.Errorf("Couldn't find Instance resource: %s", err)
 	}
 
-	reservations := out.ReservationSet
-	var reservation *computing.ReservationSetItem = nil
-	for _, v := range reservations {
-		if *v.InstancesSet[0].InstanceUniqueId == d.Id() {
-			reservation = v
+	for _, k := range changed {
+		if err := diff.ForceNew(k); err != nil {
+			return err
 		}
 	}
 
-	if reservation == nil {
+	return nil
+}
+
+// validateInstanceWindowsFields rejects admin, password and license on images
+// whose platform is not Windows, since NIFCLOUD silently ignores them there.
+func validateInstanceWindowsFields(diff *schema.ResourceDiff, meta interface{}) error {
+	var fields []string
+	for _, k := range []string{"admin", "password", "license"} {
+		if _, ok := diff.GetOk(k); ok {
+			fields = append(fields, k)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if !diff.NewValueKnown("image_id") {
+		return nil
+	}
+
+	if diff.Id() != "" && !diff.HasChange("image_id") && !diff.HasChange("admin") && !diff.HasChange("password") && !diff.HasChange("license") {
+		return nil
+	}
+
+	conn := meta.(*NifcloudClient).computingconn
+
+	imageId := diff.Get("image_id").(string)
+	out, err := conn.DescribeImages(&computing.DescribeImagesInput{
+		ImageId: []*string{nifcloud.String(imageId)},
+	})
+	if err != nil {
+		return fmt.Errorf("Error DescribeImages: %s", err)
+	}
+
+	if len(out.ImagesSet) == 0 {
+		return fmt.Errorf("Image (%s) not found", imageId)
+	}
+
+	platform := nifcloud.StringValue(out.ImagesSet[0].Platform)
+	if !strings.Contains(strings.ToLower(platform), "windows") {
+		return fmt.Errorf(
+			"%s can only be set for Windows images, but image (%s) has platform %q",
+			strings.Join(fields, ", "), imageId, platform)
+	}
+
+	return nil
+}
+
+func validateInstanceStopRequiredChanges(diff *schema.ResourceDiff, meta interface{}) error {
+	if diff.Id() != "" && instanceUpdateStopRefused(diff) {
+		return instanceUpdateStopRefusedError(diff.Get("name").(string))
+	}
+
+	return nil
+}
+
+// instanceChange is implemented by both *schema.ResourceData and
+// *schema.ResourceDiff, so plan and apply share the stop checks below.
+type instanceChange interface {
+	Get(string) interface{}
+	GetChange(string) (interface{}, interface{})
+	HasChange(string) bool
+}
+
+// instanceUpdateRequiresStop reports whether a running instance has to be
+// stopped to apply instance_type or network_interfaces.
+func instanceUpdateRequiresStop(c instanceChange) bool {
+	before, _ := c.GetChange("instance_state")
+	if before.(string) != "running" {
+		return false
+	}
+
+	reboot := c.Get("network_interfaces_reboot").(string)
+	return c.HasChange("instance_type") || (c.HasChange("network_interfaces") && reboot == "false")
+}
+
+// instanceUpdateStopRefused reports whether that stop is not allowed. Stopping
+// is always fine when the configuration stops the instance anyway.
+func instanceUpdateStopRefused(c instanceChange) bool {
+	return instanceUpdateRequiresStop(c) &&
+		c.Get("instance_state").(string) != "stopped" &&
+		!c.Get("allow_stopping_for_update").(bool)
+}
+
+func instanceUpdateStopRefusedError(name string) error {
+	return fmt.Errorf(
+		"Changing instance_type, or network_interfaces with network_interfaces_reboot = \"false\", "+
+			"requires stopping instance (%s). Set allow_stopping_for_update = true to allow it", name)
+}
+
+func expandInstanceNetworkInterfaces(interfaces []interface{}) []*computing.RequestNetworkInterfaceStruct {
+	networkInterfaces := make([]*computing.RequestNetworkInterfaceStruct, 0, len(interfaces))
+	for _, ni := range interfaces {
+		m := ni.(map[string]interface{})
+
+		networkInterface := &computing.RequestNetworkInterfaceStruct{}
+		if v, ok := m["network_id"].(string); ok && v != "" {
+			networkInterface.SetNetworkId(v)
+		}
+		if v, ok := m["network_name"].(string); ok && v != "" {
+			networkInterface.SetNetworkName(v)
+		}
+		if v, ok := m["ipaddress"].(string); ok && v != "" {
+			networkInterface.SetIpAddress(v)
+		}
+
+		networkInterfaces = append(networkInterfaces, networkInterface)
+	}
+
+	return networkInterfaces
+}
+
+func resourceInstanceRead(d *schema.ResourceData, meta interface{}) error {
+	reservation, err := findInstanceReservation(meta, d.Get("name").(string), d.Id())
+	if err != nil {
 		return fmt.Errorf("Couldn't find Instance resource: %s", err)
 	}
 
-	return setInstanceResourceData(d, meta, reservation)
+	if reservation == nil {
+		log.Printf("[WARN] Instance (%s) not found, removing from state", d.Id())
+		d.SetId("")
+		return nil
+	}
+
+	if err := setInstanceResourceData(d, meta, reservation); err != nil {
+		return err
+	}
+
+	if d.Id() == "" {
+		return nil
+	}
+
+	// userData is only returned by DescribeInstanceAttribute, so it is only
+	// refreshed for instances created or imported with user data.
+	_, hasUserData := d.GetOk("user_data")
+	_, hasUserDataBase64 := d.GetOk("user_data_base64")
+	if hasUserData || hasUserDataBase64 {
+		content, err := describeInstanceUserData(meta, d.Get("name").(string))
+		if err != nil {
+			awsErr, ok := err.(awserr.Error)
+			if ok && awsErr.Code() == "Client.InvalidParameterNotFound.Instance" {
+				d.SetId("")
+				return nil
+			}
+			return fmt.Errorf("Error retrieving Instance: %s", err)
+		}
+
+		setInstanceUserDataHash(d, content)
+	}
+
+	instance := reservation.InstancesSet[0]
+	if err := d.Set("network_interface_addresses", flattenInstanceNetworkInterfaces(instance.NetworkInterfaceSet)); err != nil {
+		return err
+	}
+
+	return setInstanceNetworkInterfaces(d, instance.NetworkInterfaceSet)
 }
 
 func InstanceStateRefreshFunc(meta interface{}, instanceId string, failStates []string) resource.StateRefreshFunc {
@@ -534,6 +1348,8 @@ func setInstanceResourceData(d *schema.ResourceData, meta interface{}, reservati
 	instance := reservation.InstancesSet[0]
 	d.Set("name", instance.InstanceId)
 
+	// DescribeInstances does not report disableApiTermination, so it costs one
+	// DescribeInstanceAttribute call per instance.
 	outDisableApiTermination, err := conn.DescribeInstanceAttribute(&computing.DescribeInstanceAttributeInput{
 		InstanceId: nifcloud.String(d.Get("name").(string)),
 		Attribute:  nifcloud.String("disableApiTermination"),
@@ -548,39 +1364,36 @@ func setInstanceResourceData(d *schema.ResourceData, meta interface{}, reservati
 		return fmt.Errorf("Error retrieving Instance: %s", err)
 	}
 
-	outUserData, err := conn.DescribeInstanceAttribute(&computing.DescribeInstanceAttributeInput{
-		InstanceId: nifcloud.String(d.Get("name").(string)),
-		Attribute:  nifcloud.String("userData"),
-	})
-
-	if err != nil {
-		awsErr, ok := err.(awserr.Error)
-		if ok && awsErr.Code() == "Client.InvalidParameterNotFound.Instance" {
-			d.SetId("")
-			return nil
-		}
-		return fmt.Errorf("Error retrieving Instance: %s", err)
-	}
-
 	d.Set("image_id", instance.ImageId)
 	d.Set("instance_type", instance.InstanceType)
-	d.Set("accounting_type", instance.AccountingType)
+	d.Set("accounting_type", instanceAccountingType(instance))
 	d.Set("description", instance.Description)
 	d.Set("availability_zone", instance.Placement.AvailabilityZone)
-	d.Set("user_data", outUserData.UserData)
 	d.Set("ip_type", instance.IpType)
 
 	disableApiTermination, _ := strconv.ParseBool(*outDisableApiTermination.DisableApiTermination.Value)
 	d.Set("disable_api_termination", disableApiTermination)
 
+	// Both are ForceNew and only reported for some platforms, so an empty value
+	// must not look like a change.
 	// only windows
-	d.Set("admin", instance.Admin)
+	if nifcloud.StringValue(instance.Admin) != "" {
+		d.Set("admin", instance.Admin)
+	}
 
 	// only linux
-	d.Set("key_name", instance.KeyName)
+	if nifcloud.StringValue(instance.KeyName) != "" {
+		d.Set("key_name", instance.KeyName)
+	}
 
 	d.Set("instance_state", instance.InstanceState.Name)
 
+	d.Set("instance_unique_id", instance.InstanceUniqueId)
+	d.Set("public_ip", instance.IpAddress)
+	d.Set("private_ip", instance.PrivateIpAddress)
+	d.Set("dns_name", instance.DnsName)
+	d.Set("launch_time", instance.LaunchTime)
+
 	sgs := make([]string, 0, len(reservation.GroupSet))
 	for _, sg := range reservation.GroupSet {
 		sgs = append(sgs, *sg.GroupId)
@@ -593,3 +1406,103 @@ func setInstanceResourceData(d *schema.ResourceData, meta interface{}, reservati
 
 	return nil
 }
+
+// instanceAccountingType returns the accounting type the instance is set to.
+// NIFCLOUD applies a change from next month, keeping the current type in
+// accountingType until then, so the pending one is read when present.
+func instanceAccountingType(instance *computing.InstancesSetItem) string {
+	if v := nifcloud.StringValue(instance.NextMonthAccountingType); v != "" {
+		return v
+	}
+
+	return nifcloud.StringValue(instance.AccountingType)
+}
+
+// describeInstanceUserData returns the decoded user data of the instance.
+func describeInstanceUserData(meta interface{}, name string) (string, error) {
+	conn := meta.(*NifcloudClient).computingconn
+
+	out, err := conn.DescribeInstanceAttribute(&computing.DescribeInstanceAttributeInput{
+		InstanceId: nifcloud.String(name),
+		Attribute:  nifcloud.String("userData"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if out.UserData == nil || nifcloud.StringValue(out.UserData.Value) == "" {
+		return "", nil
+	}
+
+	// DescribeInstanceAttribute returns the body base64 encoded.
+	content, err := decodeUserDataContent(*out.UserData.Value)
+	if err != nil {
+		return *out.UserData.Value, nil
+	}
+
+	return content, nil
+}
+
+// setInstanceUserDataHash keeps only the hash of the user data in state, under
+// whichever of user_data and user_data_base64 is in use.
+func setInstanceUserDataHash(d *schema.ResourceData, content string) {
+	if content == "" {
+		return
+	}
+
+	if _, ok := d.GetOk("user_data_base64"); ok {
+		d.Set("user_data_base64", userDataHashSum(content))
+	} else {
+		d.Set("user_data", userDataHashSum(content))
+	}
+}
+
+// setInstanceNetworkInterfaces mirrors the shape of the configured interfaces,
+// so that optional fields the user left unset do not show up as a diff.
+func setInstanceNetworkInterfaces(d *schema.ResourceData, networkInterfaces []*computing.NetworkInterfaceSetItem) error {
+	configured := map[string]map[string]interface{}{}
+	if v, ok := d.GetOk("network_interfaces"); ok {
+		for _, ni := range v.(*schema.Set).List() {
+			m := ni.(map[string]interface{})
+			if id := m["network_id"].(string); id != "" {
+				configured[id] = m
+			} else {
+				configured[m["network_name"].(string)] = m
+			}
+		}
+	}
+
+	result := make([]map[string]interface{}, 0, len(networkInterfaces))
+	for _, ni := range networkInterfaces {
+		networkId := nifcloud.StringValue(ni.NiftyNetworkId)
+		networkName := nifcloud.StringValue(ni.NiftyNetworkName)
+		ipAddress := nifcloud.StringValue(ni.IpAddress)
+		if ipAddress == "" {
+			ipAddress = nifcloud.StringValue(ni.PrivateIpAddress)
+		}
+
+		networkInterface := map[string]interface{}{}
+		if c, ok := configured[networkName]; ok && networkName != "" && c["network_id"].(string) == "" {
+			networkInterface["network_name"] = networkName
+			if c["ipaddress"].(string) != "" {
+				networkInterface["ipaddress"] = ipAddress
+			}
+		} else {
+			networkInterface["network_id"] = networkId
+			if c, ok := configured[networkId]; ok && c["ipaddress"].(string) != "" {
+				networkInterface["ipaddress"] = ipAddress
+			}
+		}
+
+		result = append(result, networkInterface)
+	}
+
+	return d.Set("network_interfaces", result)
+}
+
+func validateDuration(v interface{}, k string) (ws []string, errors []error) {
+	if _, err := time.ParseDuration(v.(string)); err != nil {
+		errors = append(errors, fmt.Errorf("%q must be a valid duration such as \"5m\": %s", k, err))
+	}
+	return
+}
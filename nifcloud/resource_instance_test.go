@@ -0,0 +1,353 @@
+package nifcloud
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/kzmake/nifcloud-sdk-go/nifcloud"
+	"github.com/kzmake/nifcloud-sdk-go/service/computing"
+)
+
+// testResourceInstanceDiff plans raw against an existing instance whose state
+// was created from stateRaw, without calling the API.
+func testResourceInstanceDiff(t *testing.T, r *schema.Resource, stateRaw, raw map[string]interface{}) (*terraform.InstanceDiff, error) {
+	t.Helper()
+
+	d := schema.TestResourceDataRaw(t, r.Schema, stateRaw)
+	d.SetId("test")
+
+	c, err := config.NewRawConfig(raw)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return r.Diff(d.State(), terraform.NewResourceConfig(c), nil)
+}
+
+func testInstanceRaw(extra map[string]interface{}) map[string]interface{} {
+	raw := map[string]interface{}{
+		"name":           "web001",
+		"image_id":       "26",
+		"key_name":       "deployerkey",
+		"instance_state": "running",
+	}
+	for k, v := range extra {
+		raw[k] = v
+	}
+	return raw
+}
+
+func testDiffAttributes(diff *terraform.InstanceDiff, prefix string) map[string]*terraform.ResourceAttrDiff {
+	attributes := map[string]*terraform.ResourceAttrDiff{}
+	if diff == nil {
+		return attributes
+	}
+	for k, v := range diff.Attributes {
+		if strings.HasPrefix(k, prefix) {
+			attributes[k] = v
+		}
+	}
+	return attributes
+}
+
+func TestResourceInstanceDiff_networkInterfacesUnconfigured(t *testing.T) {
+	stateRaw := testInstanceRaw(map[string]interface{}{
+		"network_interfaces": []interface{}{
+			map[string]interface{}{"network_id": "net-COMMON_GLOBAL"},
+			map[string]interface{}{"network_id": "net-COMMON_PRIVATE"},
+		},
+	})
+
+	diff, err := testResourceInstanceDiff(t, resourceInstance(), stateRaw, testInstanceRaw(nil))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if attributes := testDiffAttributes(diff, "network_interfaces"); len(attributes) != 0 {
+		t.Fatalf("expected no network_interfaces diff when unconfigured, got %#v", attributes)
+	}
+}
+
+func TestResourceInstanceDiff_networkInterfacesReboot(t *testing.T) {
+	stateRaw := testInstanceRaw(map[string]interface{}{
+		"allow_stopping_for_update": false,
+		"network_interfaces": []interface{}{
+			map[string]interface{}{"network_id": "net-COMMON_GLOBAL"},
+		},
+	})
+
+	cases := map[string]bool{
+		"false": true,
+		"true":  false,
+		"force": false,
+	}
+
+	for reboot, expectErr := range cases {
+		raw := testInstanceRaw(map[string]interface{}{
+			"allow_stopping_for_update": false,
+			"network_interfaces_reboot": reboot,
+			"network_interfaces": []interface{}{
+				map[string]interface{}{"network_id": "net-COMMON_GLOBAL"},
+				map[string]interface{}{"network_id": "net-COMMON_PRIVATE"},
+			},
+		})
+
+		diff, err := testResourceInstanceDiff(t, resourceInstance(), stateRaw, raw)
+		if (err != nil) != expectErr {
+			t.Fatalf("network_interfaces_reboot = %q: expected error %t, got %v", reboot, expectErr, err)
+		}
+
+		if err == nil && diff.RequiresNew() {
+			t.Fatalf("network_interfaces_reboot = %q: expected in-place update, got replacement", reboot)
+		}
+	}
+}
+
+func TestResourceInstanceDiff_userData(t *testing.T) {
+	stateRaw := testInstanceRaw(map[string]interface{}{
+		"user_data": "#!/bin/sh\necho hello\n",
+	})
+
+	gzipped, _ := testGzipBase64(t, "#!/bin/sh\necho hello\n")
+
+	cases := map[string]struct {
+		raw         map[string]interface{}
+		requiresNew bool
+	}{
+		"same content": {
+			raw:         map[string]interface{}{"user_data": "#!/bin/sh\r\necho hello  \r\n"},
+			requiresNew: false,
+		},
+		"same content moved to user_data_base64": {
+			raw:         map[string]interface{}{"user_data_base64": "IyEvYmluL3NoCmVjaG8gaGVsbG8K"},
+			requiresNew: false,
+		},
+		"same content gzip compressed in user_data_base64": {
+			raw:         map[string]interface{}{"user_data_base64": gzipped},
+			requiresNew: false,
+		},
+		"changed content": {
+			raw:         map[string]interface{}{"user_data": "#!/bin/sh\necho bye\n"},
+			requiresNew: true,
+		},
+		"changed content in user_data_base64": {
+			raw:         map[string]interface{}{"user_data_base64": "IyEvYmluL3NoCmVjaG8gYnllCg=="},
+			requiresNew: true,
+		},
+		"removed": {
+			raw:         map[string]interface{}{},
+			requiresNew: true,
+		},
+	}
+
+	for name, tc := range cases {
+		diff, err := testResourceInstanceDiff(t, resourceInstance(), stateRaw, testInstanceRaw(tc.raw))
+		if err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+
+		if diff.RequiresNew() != tc.requiresNew {
+			t.Fatalf("%s: expected RequiresNew %t, got diff %#v", name, tc.requiresNew, diff)
+		}
+	}
+}
+
+// TestResourceInstanceDiff_fields checks how a change to each field is planned:
+// an in-place update for fields resourceInstanceUpdate applies (or that only
+// affect the provider), a replacement for ForceNew fields, and a validation
+// error for computed-only fields. It runs offline, so it cannot catch Read
+// reporting a different value than was applied; those cases are tested on the
+// read helpers, such as TestInstanceAccountingType.
+func TestResourceInstanceDiff_fields(t *testing.T) {
+	const (
+		update   = "update"
+		replace  = "replace"
+		computed = "computed"
+	)
+
+	networkInterface := func(id string) map[string]interface{} {
+		return map[string]interface{}{"network_id": id}
+	}
+	license := func(num string) map[string]interface{} {
+		return map[string]interface{}{"license_name": "RDS", "license_num": num}
+	}
+
+	cases := map[string]struct {
+		old, new interface{}
+		expect   string
+		// The admin, password and license check looks the image up through the
+		// API, so those cases plan without CustomizeDiff.
+		windows bool
+	}{
+		"name":                        {old: "web001", new: "web002", expect: update},
+		"image_id":                    {old: "26", new: "27", expect: replace},
+		"key_name":                    {old: "deployerkey", new: "otherkey", expect: replace},
+		"security_groups":             {old: []interface{}{"fw1"}, new: []interface{}{"fw2"}, expect: update},
+		"user_data":                   {old: "a", new: "b", expect: replace},
+		"user_data_base64":            {old: "YQ==", new: "Yg==", expect: replace},
+		"instance_type":               {old: "small", new: "medium", expect: update},
+		"availability_zone":           {old: "east-11", new: "east-12", expect: replace},
+		"disable_api_termination":     {old: false, new: true, expect: update},
+		"accounting_type":             {old: "2", new: "1", expect: update},
+		"admin":                       {old: "admin1", new: "admin2", expect: replace, windows: true},
+		"password":                    {old: "password1", new: "password2", expect: replace, windows: true},
+		"ip_type":                     {old: "static", new: "elastic", expect: update},
+		"public_ip":                   {old: "192.0.2.1", new: "192.0.2.2", expect: replace},
+		"private_ip":                  {new: "10.0.0.1", expect: computed},
+		"dns_name":                    {new: "example.com", expect: computed},
+		"agreement":                   {old: false, new: true, expect: replace},
+		"description":                 {old: "a", new: "b", expect: update},
+		"network_interfaces":          {old: []interface{}{networkInterface("net-COMMON_GLOBAL")}, new: []interface{}{networkInterface("net-COMMON_PRIVATE")}, expect: update},
+		"network_interfaces_reboot":   {old: "false", new: "true", expect: update},
+		"license":                     {old: []interface{}{license("1")}, new: []interface{}{license("2")}, expect: replace, windows: true},
+		"network_interface_addresses": {new: []interface{}{map[string]interface{}{"ipaddress": "10.0.0.1"}}, expect: computed},
+		"instance_unique_id":          {new: "i-0123abcd", expect: computed},
+		"launch_time":                 {new: "2018-01-01T00:00:00Z", expect: computed},
+		"instance_state":              {old: "running", new: "stopped", expect: update},
+		"reboot_trigger":              {old: "1", new: "2", expect: update},
+		"force_reboot":                {old: false, new: true, expect: update},
+		"readiness_check_port":        {old: 0, new: 22, expect: update},
+		"readiness_check_ip_type":     {old: "public", new: "private", expect: update},
+		"readiness_check_timeout":     {old: "5m", new: "10m", expect: update},
+		"wait_for_status_check":       {old: false, new: true, expect: update},
+		"final_snapshot_name":         {old: "", new: "snapshot", expect: update},
+		"final_image_name":            {old: "", new: "image", expect: update},
+		"final_backup_timeout":        {old: "60m", new: "90m", expect: update},
+		"allow_stopping_for_update":   {old: true, new: false, expect: update},
+	}
+
+	for k := range resourceInstance().Schema {
+		if _, ok := cases[k]; !ok {
+			t.Errorf("%s: no case, classify it as updatable, ForceNew or computed", k)
+		}
+	}
+
+	for k, tc := range cases {
+		r := resourceInstance()
+		if tc.windows {
+			r.CustomizeDiff = nil
+		}
+
+		if tc.expect == computed {
+			c, err := config.NewRawConfig(testInstanceRaw(map[string]interface{}{k: tc.new}))
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if _, errs := r.Validate(terraform.NewResourceConfig(c)); len(errs) == 0 {
+				t.Errorf("%s: expected computed-only field to be rejected in configuration", k)
+			}
+			continue
+		}
+
+		diff, err := testResourceInstanceDiff(t, r,
+			testInstanceRaw(map[string]interface{}{k: tc.old}),
+			testInstanceRaw(map[string]interface{}{k: tc.new}))
+		if err != nil {
+			t.Errorf("%s: err: %s", k, err)
+			continue
+		}
+
+		changed := false
+		for attr, v := range diff.Attributes {
+			if (attr == k || strings.HasPrefix(attr, k+".")) && (v.Old != v.New || v.NewRemoved) {
+				changed = true
+			}
+		}
+		if !changed {
+			t.Errorf("%s: expected a change in the plan", k)
+		}
+
+		if diff.RequiresNew() != (tc.expect == replace) {
+			t.Errorf("%s: expected %s, got RequiresNew %t", k, tc.expect, diff.RequiresNew())
+		}
+	}
+}
+
+func TestResourceInstanceDiff_stopRequired(t *testing.T) {
+	stateRaw := testInstanceRaw(map[string]interface{}{
+		"allow_stopping_for_update": false,
+		"instance_type":             "small",
+	})
+
+	cases := map[string]struct {
+		raw       map[string]interface{}
+		expectErr bool
+	}{
+		"instance_type on a running instance": {
+			raw:       map[string]interface{}{"instance_type": "medium"},
+			expectErr: true,
+		},
+		"instance_type while stopping the instance": {
+			raw:       map[string]interface{}{"instance_type": "medium", "instance_state": "stopped"},
+			expectErr: false,
+		},
+		"instance_type with stopping allowed": {
+			raw:       map[string]interface{}{"instance_type": "medium", "allow_stopping_for_update": true},
+			expectErr: false,
+		},
+	}
+
+	for name, tc := range cases {
+		raw := testInstanceRaw(map[string]interface{}{"allow_stopping_for_update": false})
+		for k, v := range tc.raw {
+			raw[k] = v
+		}
+
+		_, err := testResourceInstanceDiff(t, resourceInstance(), stateRaw, raw)
+		if (err != nil) != tc.expectErr {
+			t.Fatalf("%s: expected error %t, got %v", name, tc.expectErr, err)
+		}
+
+		// Apply refuses the stop with the same predicate the plan uses.
+		d := schema.TestResourceDataRaw(t, resourceInstance().Schema, raw)
+		if refused := instanceUpdateStopRefused(testInstanceChange{d, stateRaw}); refused != tc.expectErr {
+			t.Fatalf("%s: expected apply to refuse %t, got %t", name, tc.expectErr, refused)
+		}
+	}
+}
+
+// testInstanceChange pairs new values from d with old values from state, as
+// ResourceData does during apply.
+type testInstanceChange struct {
+	*schema.ResourceData
+	state map[string]interface{}
+}
+
+func (c testInstanceChange) GetChange(k string) (interface{}, interface{}) {
+	old, ok := c.state[k]
+	if !ok {
+		old, _ = resourceInstance().Schema[k].DefaultValue()
+	}
+	return old, c.Get(k)
+}
+
+func (c testInstanceChange) HasChange(k string) bool {
+	old, new := c.GetChange(k)
+	return old != new
+}
+
+func TestInstanceAccountingType(t *testing.T) {
+	cases := map[string]struct {
+		current, nextMonth *string
+		expected           string
+	}{
+		"no pending change": {current: nifcloud.String("2"), expected: "2"},
+		"empty pending":     {current: nifcloud.String("2"), nextMonth: nifcloud.String(""), expected: "2"},
+		"pending change":    {current: nifcloud.String("2"), nextMonth: nifcloud.String("1"), expected: "1"},
+	}
+
+	for name, tc := range cases {
+		instance := &computing.InstancesSetItem{
+			AccountingType:          tc.current,
+			NextMonthAccountingType: tc.nextMonth,
+		}
+
+		if v := instanceAccountingType(instance); v != tc.expected {
+			t.Fatalf("%s: expected %q, got %q", name, tc.expected, v)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package nifcloud
 
 import (
 	"fmt"
+	"log"
+	"strings"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/helper/validation"
@@ -17,6 +19,12 @@ func resourceKeyPair() *schema.Resource {
 		Read:   resourceKeyPairRead,
 		Update: resourceKeyPairUpdate,
 		Delete: resourceKeyPairDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		CustomizeDiff: resourceKeyPairCustomizeDiff,
+
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Type:         schema.TypeString,
@@ -25,8 +33,34 @@ func resourceKeyPair() *schema.Resource {
 				ValidateFunc: validation.StringLenBetween(6, 32),
 			},
 			"public_key_material": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				ConflictsWith:    []string{"password", "pgp_key"},
+				ValidateFunc:     validatePublicKeyMaterial,
+				DiffSuppressFunc: suppressEquivalentPublicKeyDiffs,
+			},
+			"password": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				Sensitive:     true,
+				ConflictsWith: []string{"public_key_material"},
+			},
+			"pgp_key": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"public_key_material"},
+			},
+			"private_key": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"encrypted_private_key": {
 				Type:     schema.TypeString,
-				Required: true,
+				Computed: true,
 			},
 			"description": {
 				Type:         schema.TypeString,
@@ -41,12 +75,41 @@ func resourceKeyPair() *schema.Resource {
 	}
 }
 
+// resourceKeyPairCustomizeDiff rejects a key pair that can be neither imported
+// nor generated during plan, rather than when CreateKeyPair is reached.
+func resourceKeyPairCustomizeDiff(diff *schema.ResourceDiff, meta interface{}) error {
+	if diff.Id() != "" {
+		return nil
+	}
+
+	if !diff.NewValueKnown("public_key_material") || !diff.NewValueKnown("password") {
+		return nil
+	}
+
+	_, hasPublicKey := diff.GetOk("public_key_material")
+	_, hasPassword := diff.GetOk("password")
+	if !hasPublicKey && !hasPassword {
+		return fmt.Errorf("one of public_key_material or password must be set, to import a key or generate one")
+	}
+
+	return nil
+}
+
 func resourceKeyPairCreate(d *schema.ResourceData, meta interface{}) error {
 	conn := meta.(*NifcloudClient).computingconn
 
+	if _, ok := d.GetOk("public_key_material"); !ok {
+		return resourceKeyPairGenerate(d, meta)
+	}
+
+	publicKeyMaterial, err := encodePublicKeyMaterial(d.Get("public_key_material").(string))
+	if err != nil {
+		return err
+	}
+
 	input := computing.ImportKeyPairInput{
 		KeyName:           nifcloud.String(d.Get("name").(string)),
-		PublicKeyMaterial: nifcloud.String(d.Get("public_key_material").(string)),
+		PublicKeyMaterial: nifcloud.String(publicKeyMaterial),
 		Description:       nifcloud.String(d.Get("description").(string)),
 	}
 
@@ -58,14 +121,74 @@ func resourceKeyPairCreate(d *schema.ResourceData, meta interface{}) error {
 	return resourceKeyPairRead(d, meta)
 }
 
+// resourceKeyPairGenerate lets NIFCLOUD generate the key pair and keeps the
+// returned private key in state, PGP-encrypted when pgp_key is given.
+func resourceKeyPairGenerate(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*NifcloudClient).computingconn
+
+	password, ok := d.GetOk("password")
+	if !ok {
+		return fmt.Errorf("password is required to generate a key pair when public_key_material is not set")
+	}
+
+	input := computing.CreateKeyPairInput{
+		KeyName:     nifcloud.String(d.Get("name").(string)),
+		Password:    nifcloud.String(password.(string)),
+		Description: nifcloud.String(d.Get("description").(string)),
+	}
+
+	out, err := conn.CreateKeyPair(&input)
+	if err != nil {
+		return fmt.Errorf("Error CreateKeyPair: %s", err)
+	}
+	d.SetId(*out.KeyName)
+
+	if v, ok := d.GetOk("pgp_key"); ok {
+		encrypted, err := encryptValue(v.(string), nifcloud.StringValue(out.KeyMaterial), "KeyPair Private Key")
+		if err != nil {
+			return err
+		}
+		d.Set("encrypted_private_key", encrypted)
+	} else {
+		d.Set("private_key", out.KeyMaterial)
+	}
+
+	return resourceKeyPairRead(d, meta)
+}
+
 func resourceKeyPairDelete(d *schema.ResourceData, meta interface{}) error {
 	conn := meta.(*NifcloudClient).computingconn
 
+	out, err := conn.DescribeKeyPairs(&computing.DescribeKeyPairsInput{
+		KeyName: []*string{nifcloud.String(d.Id())},
+	})
+	if err != nil {
+		if isKeyPairNotFoundError(err) {
+			return nil
+		}
+		return fmt.Errorf("Error retrieving KeyPair: %s", err)
+	}
+
+	for _, key := range out.KeySet {
+		if *key.KeyName != d.Id() || len(key.InstancesSet) == 0 {
+			continue
+		}
+
+		instances := make([]string, 0, len(key.InstancesSet))
+		for _, i := range key.InstancesSet {
+			instances = append(instances, nifcloud.StringValue(i.InstanceId))
+		}
+
+		return fmt.Errorf(
+			"KeyPair (%s) is still used by instances: %s. Destroy or replace them before deleting the key pair",
+			d.Id(), strings.Join(instances, ", "))
+	}
+
 	input := computing.DeleteKeyPairInput{
 		KeyName: nifcloud.String(d.Id()),
 	}
 
-	_, err := conn.DeleteKeyPair(&input)
+	_, err = conn.DeleteKeyPair(&input)
 	if err != nil {
 		return fmt.Errorf("Error DeleteKeyPair: %s", err)
 	}
@@ -76,15 +199,17 @@ func resourceKeyPairDelete(d *schema.ResourceData, meta interface{}) error {
 func resourceKeyPairUpdate(d *schema.ResourceData, meta interface{}) error {
 	conn := meta.(*NifcloudClient).computingconn
 
-	input := computing.NiftyModifyKeyPairAttributeInput{
-		KeyName:   nifcloud.String(d.Id()),
-		Attribute: nifcloud.String("description"),
-		Value:     nifcloud.String(d.Get("description").(string)),
-	}
+	if d.HasChange("description") {
+		input := computing.NiftyModifyKeyPairAttributeInput{
+			KeyName:   nifcloud.String(d.Id()),
+			Attribute: nifcloud.String("description"),
+			Value:     nifcloud.String(d.Get("description").(string)),
+		}
 
-	_, err := conn.NiftyModifyKeyPairAttribute(&input)
-	if err != nil {
-		return fmt.Errorf("Error NiftyModifyKeyPairAttribute: %s", err)
+		_, err := conn.NiftyModifyKeyPairAttribute(&input)
+		if err != nil {
+			return fmt.Errorf("Error NiftyModifyKeyPairAttribute: %s", err)
+		}
 	}
 
 	return resourceKeyPairRead(d, meta)
@@ -99,8 +224,8 @@ func resourceKeyPairRead(d *schema.ResourceData, meta interface{}) error {
 
 	out, err := conn.DescribeKeyPairs(input)
 	if err != nil {
-		awsErr, ok := err.(awserr.Error)
-		if ok && awsErr.Code() == "InvalidKeyPair.NotFound" {
+		if isKeyPairNotFoundError(err) {
+			log.Printf("[WARN] KeyPair (%s) not found, removing from state", d.Id())
 			d.SetId("")
 			return nil
 		}
@@ -109,12 +234,40 @@ func resourceKeyPairRead(d *schema.ResourceData, meta interface{}) error {
 
 	for _, key := range out.KeySet {
 		if *key.KeyName == d.Id() {
-			d.Set("key_name", key.KeyName)
+			d.Set("name", key.KeyName)
 			d.Set("fingerprint", key.KeyFingerprint)
 			d.Set("description", key.Description)
+
+			if v, ok := d.GetOk("public_key_material"); ok {
+				// It is not confirmed that NIFCLOUD fingerprints the OpenSSH key
+				// blob, so a mismatch is only logged rather than forcing a new key.
+				remote := strings.ToLower(nifcloud.StringValue(key.KeyFingerprint))
+				local, err := publicKeyFingerprint(v.(string))
+				if err == nil && remote != local {
+					log.Printf("[WARN] KeyPair (%s) fingerprint %s does not match the MD5 fingerprint of public_key_material (%s)", d.Id(), remote, local)
+				}
+			}
+
 			return nil
 		}
 	}
 
-	return fmt.Errorf("Unable to find key pair within: %#v", out.KeySet)
+	log.Printf("[WARN] KeyPair (%s) not found, removing from state", d.Id())
+	d.SetId("")
+
+	return nil
+}
+
+func isKeyPairNotFoundError(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+
+	switch awsErr.Code() {
+	case "InvalidKeyPair.NotFound", "Client.InvalidParameterNotFound.KeyPair", "Client.InvalidParameterNotFound.KeyName":
+		return true
+	}
+
+	return false
 }
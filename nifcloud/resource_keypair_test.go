@@ -0,0 +1,116 @@
+package nifcloud
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestResourceKeyPairDiff_publicKeyMaterial(t *testing.T) {
+	cases := map[string]struct {
+		state       string
+		config      string
+		requiresNew bool
+	}{
+		// DescribeKeyPairs does not return the key, so an import leaves it empty.
+		"imported": {
+			state:       "",
+			config:      testPublicKeyEd25519 + " imported@example",
+			requiresNew: false,
+		},
+		"same key in another form": {
+			state:       testPublicKeyEd25519,
+			config:      base64.StdEncoding.EncodeToString([]byte(testPublicKeyEd25519 + " user@example")),
+			requiresNew: false,
+		},
+		"other key": {
+			state:       testPublicKeyEd25519,
+			config:      testPublicKeyRSA,
+			requiresNew: true,
+		},
+	}
+
+	for name, tc := range cases {
+		state := &terraform.InstanceState{
+			ID: "deployerkey",
+			Attributes: map[string]string{
+				"name":                "deployerkey",
+				"public_key_material": tc.state,
+				"fingerprint":         "00:11:22:33:44:55:66:77:88:99:aa:bb:cc:dd:ee:ff",
+			},
+		}
+
+		c, err := config.NewRawConfig(map[string]interface{}{
+			"name":                "deployerkey",
+			"public_key_material": tc.config,
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		diff, err := resourceKeyPair().Diff(state, terraform.NewResourceConfig(c), nil)
+		if err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+
+		if diff.RequiresNew() != tc.requiresNew {
+			t.Fatalf("%s: expected RequiresNew %t, got diff %#v", name, tc.requiresNew, diff)
+		}
+	}
+}
+
+func TestResourceKeyPairDiff_keySource(t *testing.T) {
+	cases := map[string]struct {
+		raw       map[string]interface{}
+		expectErr bool
+	}{
+		"public_key_material": {
+			raw:       map[string]interface{}{"public_key_material": testPublicKeyEd25519},
+			expectErr: false,
+		},
+		"password": {
+			raw:       map[string]interface{}{"password": "secretpassword"},
+			expectErr: false,
+		},
+		"neither": {
+			raw:       map[string]interface{}{},
+			expectErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		raw := map[string]interface{}{"name": "deployerkey"}
+		for k, v := range tc.raw {
+			raw[k] = v
+		}
+
+		c, err := config.NewRawConfig(raw)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		_, err = resourceKeyPair().Diff(nil, terraform.NewResourceConfig(c), nil)
+		if (err != nil) != tc.expectErr {
+			t.Fatalf("%s: expected error %t, got %v", name, tc.expectErr, err)
+		}
+	}
+}
+
+func TestResourceKeyPairDiff_importedWithoutKeySource(t *testing.T) {
+	// A key pair generated elsewhere and imported has neither in config.
+	state := &terraform.InstanceState{
+		ID:         "deployerkey",
+		Attributes: map[string]string{"name": "deployerkey"},
+	}
+
+	c, err := config.NewRawConfig(map[string]interface{}{"name": "deployerkey"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := resourceKeyPair().Diff(state, terraform.NewResourceConfig(c), nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/kzmake/nifcloud-sdk-go/nifcloud/awserr"
 	"github.com/kzmake/nifcloud-sdk-go/service/computing"
 	"log"
+	"net"
+	"strings"
 	"time"
 )
 
@@ -18,12 +20,17 @@ func resourceNetwork() *schema.Resource {
 		Read:   resourceNetworkRead,
 		Update: resourceNetworkUpdate,
 		Delete: resourceNetworkDelete,
-		Importer: &schema.ResourceImporter{},
+
+		CustomizeDiff: resourceNetworkCustomizeDiff,
+
+		Importer: &schema.ResourceImporter{
+			State: resourceNetworkImportState,
+		},
 
 		Timeouts: &schema.ResourceTimeout{
 			Create: schema.DefaultTimeout(1 * time.Minute),
 			Update: schema.DefaultTimeout(1 * time.Minute),
-			Delete: schema.DefaultTimeout(1 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
 		},
 
 		Schema: map[string]*schema.Schema{
@@ -34,8 +41,9 @@ func resourceNetwork() *schema.Resource {
 				ValidateFunc: validation.StringLenBetween(1, 15),
 			},
 			"cidr_block": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.CIDRNetwork(16, 28),
 			},
 			"availability_zone": {
 				Type:     schema.TypeString,
@@ -56,6 +64,16 @@ func resourceNetwork() *schema.Resource {
 				Type:     schema.TypeString,
 				Computed: true,
 			},
+			"instances": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"routers": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
 		},
 	}
 }
@@ -109,7 +127,29 @@ func resourceNetworkDelete(d *schema.ResourceData, meta interface{}) error {
 		NetworkId: nifcloud.String(d.Id()),
 	}
 
-	if _, err := conn.NiftyDeletePrivateLan(&input); err != nil {
+	// Instances and routers are often still detaching while Terraform destroys
+	// them in parallel, so keep retrying while the network still lists them.
+	// The decision is made on the attachments NIFCLOUD reports rather than on
+	// the error code, so unrelated failures are not retried.
+	err := resource.Retry(d.Timeout(schema.TimeoutDelete), func() *resource.RetryError {
+		_, err := conn.NiftyDeletePrivateLan(&input)
+		if err == nil {
+			return nil
+		}
+
+		if _, ok := err.(awserr.Error); !ok {
+			return resource.NonRetryableError(err)
+		}
+
+		dependents, describeErr := networkDependents(meta, d.Id())
+		if describeErr != nil || len(dependents) == 0 {
+			return resource.NonRetryableError(err)
+		}
+
+		log.Printf("[DEBUG] Network (%s) is still in use by %s, retrying", d.Id(), strings.Join(dependents, ", "))
+		return resource.RetryableError(err)
+	})
+	if err != nil {
 		return fmt.Errorf("Error NiftyDeletePrivateLanInput: %s", err)
 	}
 
@@ -132,78 +172,79 @@ func resourceNetworkDelete(d *schema.ResourceData, meta interface{}) error {
 	return nil
 }
 
-func resourceNetworkUpdate(d *schema.ResourceData, meta interface{}) error {
+// networkDependents lists the resources still attached to the network.
+func networkDependents(meta interface{}, networkId string) ([]string, error) {
 	conn := meta.(*NifcloudClient).computingconn
 
-	updateStateConf := &resource.StateChangeConf{
-		Pending:    []string{"pending"},
-		Target:     []string{"available"},
-		Refresh:    NetworkStateRefreshFunc(meta, d.Id(), []string{"terminated"}),
-		Timeout:    d.Timeout(schema.TimeoutUpdate),
-		Delay:      5 * time.Second,
-		MinTimeout: 5 * time.Second,
+	out, err := conn.NiftyDescribePrivateLans(&computing.NiftyDescribePrivateLansInput{
+		NetworkId: []*string{nifcloud.String(networkId)},
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if d.HasChange("description") {
-		_, err := conn.NiftyModifyPrivateLanAttribute(&computing.NiftyModifyPrivateLanAttributeInput{
-			NetworkId: nifcloud.String(d.Id()),
-			Attribute: nifcloud.String("description"),
-			Value:     nifcloud.String(d.Get("description").(string)),
-		})
-		if err != nil {
-			return fmt.Errorf("Error NiftyModifyPrivateLanAttribute: %s", err)
-		}
+	if len(out.PrivateLanSet) == 0 {
+		return nil, nil
+	}
 
-		if _, err := updateStateConf.WaitForState(); err != nil {
-			return fmt.Errorf(
-				"Error waiting for (%s) to become ready: %s",
-				d.Id(), err)
-		}
+	network := out.PrivateLanSet[0]
+
+	var dependents []string
+	for _, i := range network.InstancesSet {
+		dependents = append(dependents, "instance "+nifcloud.StringValue(i.InstanceId))
+	}
+	for _, r := range network.RouterSet {
+		dependents = append(dependents, "router "+nifcloud.StringValue(r.RouterName))
+	}
+	for _, v := range network.VpnGatewaySet {
+		dependents = append(dependents, "vpn gateway "+nifcloud.StringValue(v.NiftyVpnGatewayName))
+	}
+	for _, e := range network.ElasticLoadBalancingSet {
+		dependents = append(dependents, "load balancer "+nifcloud.StringValue(e.ElasticLoadBalancerName))
 	}
 
-	if d.HasChange("name") {
-		_, err := conn.NiftyModifyPrivateLanAttribute(&computing.NiftyModifyPrivateLanAttributeInput{
-			NetworkId: nifcloud.String(d.Id()),
-			Attribute: nifcloud.String("privateLanName"),
-			Value:     nifcloud.String(d.Get("name").(string)),
-		})
+	return dependents, nil
+}
 
-		if err != nil {
-			return fmt.Errorf("Error NiftyModifyPrivateLanAttribute: %s", err)
-		}
+func resourceNetworkUpdate(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*NifcloudClient).computingconn
 
-		if _, err := updateStateConf.WaitForState(); err != nil {
-			return fmt.Errorf(
-				"Error waiting for (%s) to become ready: %s",
-				d.Id(), err)
+	d.Partial(true)
+
+	// The attributes are sent back to back and waited for once; cidrBlock goes
+	// last since it is the change that actually reconfigures the LAN.
+	modified := false
+	for _, a := range []struct{ key, attribute string }{
+		{"name", "privateLanName"},
+		{"description", "description"},
+		{"accounting_type", "accountingType"},
+		{"cidr_block", "cidrBlock"},
+	} {
+		if !d.HasChange(a.key) {
+			continue
 		}
-	}
 
-	if d.HasChange("accounting_type") {
 		_, err := conn.NiftyModifyPrivateLanAttribute(&computing.NiftyModifyPrivateLanAttributeInput{
 			NetworkId: nifcloud.String(d.Id()),
-			Attribute: nifcloud.String("accountingType"),
-			Value:     nifcloud.String(d.Get("accounting_type").(string)),
+			Attribute: nifcloud.String(a.attribute),
+			Value:     nifcloud.String(d.Get(a.key).(string)),
 		})
 		if err != nil {
-			return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
+			return fmt.Errorf("Error NiftyModifyPrivateLanAttribute: %s", err)
 		}
 
-		if _, err := updateStateConf.WaitForState(); err != nil {
-			return fmt.Errorf(
-				"Error waiting for (%s) to become ready: %s",
-				d.Id(), err)
-		}
+		d.SetPartial(a.key)
+		modified = true
 	}
 
-	if d.HasChange("cidr_block") {
-		_, err := conn.NiftyModifyPrivateLanAttribute(&computing.NiftyModifyPrivateLanAttributeInput{
-			NetworkId: nifcloud.String(d.Id()),
-			Attribute: nifcloud.String("cidrBlock"),
-			Value:     nifcloud.String(d.Get("cidr_block").(string)),
-		})
-		if err != nil {
-			return fmt.Errorf("Error ModifyInstanceAttribute: %s", err)
+	if modified {
+		updateStateConf := &resource.StateChangeConf{
+			Pending:    []string{"pending"},
+			Target:     []string{"available"},
+			Refresh:    NetworkStateRefreshFunc(meta, d.Id(), []string{"terminated"}),
+			Timeout:    d.Timeout(schema.TimeoutUpdate),
+			Delay:      5 * time.Second,
+			MinTimeout: 5 * time.Second,
 		}
 
 		if _, err := updateStateConf.WaitForState(); err != nil {
@@ -213,9 +254,46 @@ func resourceNetworkUpdate(d *schema.ResourceData, meta interface{}) error {
 		}
 	}
 
+	d.Partial(false)
+
 	return resourceNetworkRead(d, meta)
 }
 
+// resourceNetworkImportState accepts either a NetworkId or a private LAN name.
+func resourceNetworkImportState(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	conn := meta.(*NifcloudClient).computingconn
+
+	out, err := conn.NiftyDescribePrivateLans(&computing.NiftyDescribePrivateLansInput{})
+	if err != nil {
+		return nil, fmt.Errorf("Error Import resource: %s", err)
+	}
+
+	var matches []*computing.PrivateLanSetItem
+	for _, n := range out.PrivateLanSet {
+		if nifcloud.StringValue(n.NetworkId) == d.Id() || nifcloud.StringValue(n.PrivateLanName) == d.Id() {
+			matches = append(matches, n)
+		}
+	}
+
+	if len(matches) < 1 {
+		return nil, fmt.Errorf("Error Import resource: no network found with id or name %q", d.Id())
+	}
+
+	if len(matches) > 1 {
+		return nil, fmt.Errorf(
+			"Error Import resource: %q matches %d networks by id or name, import by NetworkId instead",
+			d.Id(), len(matches))
+	}
+
+	d.SetId(*matches[0].NetworkId)
+
+	if err := setNetworkResourceData(d, meta, matches[0]); err != nil {
+		return nil, err
+	}
+
+	return []*schema.ResourceData{d}, nil
+}
+
 func resourceNetworkRead(d *schema.ResourceData, meta interface{}) error {
 	conn := meta.(*NifcloudClient).computingconn
 
@@ -233,7 +311,78 @@ func resourceNetworkRead(d *schema.ResourceData, meta interface{}) error {
 		return fmt.Errorf("Couldn't find Instance resource: %s", err)
 	}
 
-	return setNetworkResourceData(d, meta, out)
+	return setNetworkResourceData(d, meta, out.PrivateLanSet[0])
+}
+
+// resourceNetworkCustomizeDiff refuses a cidr_block change that would leave the
+// addresses of attached instances or routers outside the private LAN.
+func resourceNetworkCustomizeDiff(diff *schema.ResourceDiff, meta interface{}) error {
+	if diff.Id() == "" || !diff.HasChange("cidr_block") || !diff.NewValueKnown("cidr_block") {
+		return nil
+	}
+
+	conn := meta.(*NifcloudClient).computingconn
+
+	_, cidr, err := net.ParseCIDR(diff.Get("cidr_block").(string))
+	if err != nil {
+		return err
+	}
+
+	out, err := conn.NiftyDescribePrivateLans(&computing.NiftyDescribePrivateLansInput{
+		NetworkId: []*string{nifcloud.String(diff.Id())},
+	})
+	if err != nil {
+		return fmt.Errorf("Error NiftyDescribePrivateLans: %s", err)
+	}
+
+	if len(out.PrivateLanSet) == 0 {
+		return nil
+	}
+
+	network := out.PrivateLanSet[0]
+
+	var outside []string
+	for _, r := range network.RouterSet {
+		ip := net.ParseIP(nifcloud.StringValue(r.IpAddress))
+		if ip != nil && !cidr.Contains(ip) {
+			outside = append(outside, fmt.Sprintf("router %s (%s)", nifcloud.StringValue(r.RouterName), ip))
+		}
+	}
+
+	for _, i := range network.InstancesSet {
+		reservation, err := describeInstanceByName(conn, nifcloud.StringValue(i.InstanceId))
+		if err != nil {
+			return fmt.Errorf("Error DescribeInstances: %s", err)
+		}
+		if reservation == nil {
+			continue
+		}
+
+		for _, ni := range reservation.InstancesSet[0].NetworkInterfaceSet {
+			if nifcloud.StringValue(ni.NiftyNetworkId) != diff.Id() {
+				continue
+			}
+
+			address := nifcloud.StringValue(ni.IpAddress)
+			if address == "" {
+				address = nifcloud.StringValue(ni.PrivateIpAddress)
+			}
+
+			ip := net.ParseIP(address)
+			if ip != nil && !cidr.Contains(ip) {
+				outside = append(outside, fmt.Sprintf("instance %s (%s)", nifcloud.StringValue(i.InstanceId), ip))
+			}
+		}
+	}
+
+	if len(outside) > 0 {
+		return fmt.Errorf(
+			"cidr_block %s does not contain the addresses of resources attached to network (%s): %s. "+
+				"Re-address or detach them before changing cidr_block",
+			cidr, diff.Id(), strings.Join(outside, ", "))
+	}
+
+	return nil
 }
 
 func NetworkStateRefreshFunc(meta interface{}, networkId string, failStates []string) resource.StateRefreshFunc {
@@ -269,9 +418,7 @@ func NetworkStateRefreshFunc(meta interface{}, networkId string, failStates []st
 	}
 }
 
-func setNetworkResourceData(d *schema.ResourceData, meta interface{}, out *computing.NiftyDescribePrivateLansOutput) error {
-	network := out.PrivateLanSet[0]
-
+func setNetworkResourceData(d *schema.ResourceData, meta interface{}, network *computing.PrivateLanSetItem) error {
 	d.Set("name", network.PrivateLanName)
 	d.Set("cidr_block", network.CidrBlock)
 	d.Set("availability_zone", network.AvailabilityZone)
@@ -279,5 +426,17 @@ func setNetworkResourceData(d *schema.ResourceData, meta interface{}, out *compu
 	d.Set("description", network.Description)
 	d.Set("state", network.State)
 
+	instances := make([]string, 0, len(network.InstancesSet))
+	for _, i := range network.InstancesSet {
+		instances = append(instances, nifcloud.StringValue(i.InstanceId))
+	}
+	d.Set("instances", instances)
+
+	routers := make([]string, 0, len(network.RouterSet))
+	for _, r := range network.RouterSet {
+		routers = append(routers, nifcloud.StringValue(r.RouterId))
+	}
+	d.Set("routers", routers)
+
 	return nil
 }
@@ -0,0 +1,70 @@
+package nifcloud
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// decodeUserDataBase64 decodes a base64 user_data payload into the bytes that
+// are sent to the API as they are, gzip compressed or not.
+func decodeUserDataBase64(v string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+	if err != nil {
+		return nil, fmt.Errorf("user_data_base64 is not valid base64: %s", err)
+	}
+
+	return b, nil
+}
+
+// decodeUserDataContent returns the text of a base64 user_data payload,
+// inflating it when it is gzip compressed as cloud-init does. It is only used
+// to compare payloads, never to build the one sent to the API.
+func decodeUserDataContent(v string) (string, error) {
+	b, err := decodeUserDataBase64(v)
+	if err != nil {
+		return "", err
+	}
+
+	if len(b) > 2 && b[0] == 0x1f && b[1] == 0x8b {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return "", fmt.Errorf("user_data_base64 is not valid gzip: %s", err)
+		}
+		defer r.Close()
+
+		if b, err = ioutil.ReadAll(r); err != nil {
+			return "", fmt.Errorf("user_data_base64 is not valid gzip: %s", err)
+		}
+	}
+
+	return string(b), nil
+}
+
+// normalizeUserData removes line ending and trailing whitespace differences,
+// which cloud-init does not care about.
+func normalizeUserData(v string) string {
+	lines := strings.Split(strings.Replace(v, "\r\n", "\n", -1), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func userDataHashSum(v string) string {
+	hash := sha1.Sum([]byte(normalizeUserData(v)))
+	return hex.EncodeToString(hash[:])
+}
+
+func validateUserDataBase64(v interface{}, k string) (ws []string, errors []error) {
+	if _, err := decodeUserDataContent(v.(string)); err != nil {
+		errors = append(errors, fmt.Errorf("%q: %s", k, err))
+	}
+	return
+}
@@ -0,0 +1,58 @@
+package nifcloud
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+)
+
+func testGzipBase64(t *testing.T, v string) (string, []byte) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(v)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), buf.Bytes()
+}
+
+func TestDecodeUserDataBase64_gzip(t *testing.T) {
+	const content = "#cloud-config\npackages:\n  - nginx\n"
+	encoded, compressed := testGzipBase64(t, content)
+
+	// The payload sent to the API is the configured one, still compressed.
+	payload, err := decodeUserDataBase64(encoded)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(payload, compressed) {
+		t.Fatalf("expected the gzip payload unchanged, got %q", payload)
+	}
+
+	// Only the comparison inflates it.
+	decoded, err := decodeUserDataContent(encoded)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if decoded != content {
+		t.Fatalf("expected %q, got %q", content, decoded)
+	}
+}
+
+func TestDecodeUserDataBase64_invalid(t *testing.T) {
+	if _, err := decodeUserDataBase64("not base64!"); err == nil {
+		t.Fatal("expected an error for invalid base64")
+	}
+
+	// A gzip header followed by garbage.
+	invalidGzip := base64.StdEncoding.EncodeToString([]byte{0x1f, 0x8b, 0x00, 0x01})
+	if _, err := decodeUserDataContent(invalidGzip); err == nil {
+		t.Fatal("expected an error for invalid gzip")
+	}
+}